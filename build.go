@@ -19,6 +19,7 @@ var (
 		Long:  "build all packages by default, unless specific packages are specified",
 		Run: func(cmd *cobra.Command, packageNames []string) {
 			loader := hammer.NewLoader(viper.GetString("search"))
+			loader.Overrides = overrides(cmd)
 			loaded, err := loader.Load()
 			if err != nil {
 				logrus.WithField("error", err).Fatal("could not load packages")
@@ -102,7 +103,13 @@ var (
 			}
 
 			// build the packages!
-			if !packager.Build(ctx, viper.GetInt("concurrent-jobs")) { // Errors are already reported to the user from here
+			success := packager.Build(ctx, viper.GetInt("concurrent-jobs")) // Errors are already reported to the user from here
+
+			for _, artifact := range packager.Artifacts() {
+				logrus.WithField("sha256", artifact.SHA256).Info(artifact.Path)
+			}
+
+			if !success {
 				os.Exit(1)
 			}
 		},
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// setupConfig reads project settings from hammer.yml in the search root, if
+// present. Any flag can be set there by name (shell, output, cache,
+// concurrent-jobs...), and flags given on the command line still take
+// precedence.
+func setupConfig(cmd *cobra.Command) {
+	name := filepath.Join(viper.GetString("search"), hammer.ConfigName)
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		return
+	}
+
+	viper.SetConfigFile(name)
+	err := viper.ReadInConfig()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+			"path":  name,
+		}).Fatal("could not read project settings")
+	}
+	logrus.WithField("path", name).Debug("read project settings")
+
+	// relative paths in the settings file are relative to the file itself
+	for _, key := range []string{"output", "logs", "cache"} {
+		if !viper.InConfig(key) {
+			continue
+		}
+		if flag := cmd.Flags().Lookup(key); flag != nil && flag.Changed {
+			continue
+		}
+
+		value := viper.GetString(key)
+		if !filepath.IsAbs(value) {
+			viper.Set(key, filepath.Join(filepath.Dir(name), value))
+		}
+	}
+}
+
+// overrides collects the spec overrides for a command, in order of
+// precedence: HAMMER_VAR_* environment variables, then --set-file, then --set.
+func overrides(cmd *cobra.Command) []hammer.Override {
+	all := hammer.EnvOverrides(os.Environ())
+
+	files, err := cmd.Flags().GetStringArray("set-file")
+	if err != nil {
+		logrus.WithError(err).Fatal("could not read --set-file")
+	}
+	for _, arg := range files {
+		override, err := hammer.ParseFileOverride(arg, "--set-file")
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"arg":   arg,
+			}).Fatal("could not read --set-file")
+		}
+		all = append(all, override)
+	}
+
+	sets, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		logrus.WithError(err).Fatal("could not read --set")
+	}
+	for _, arg := range sets {
+		override, err := hammer.ParseOverride(arg, "--set")
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"arg":   arg,
+			}).Fatal("could not read --set")
+		}
+		all = append(all, override)
+	}
+
+	return all
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	fmtCmd = &cobra.Command{
+		Use:   "fmt [spec...]",
+		Short: "format specs",
+		Long:  "rewrite YAML specs (all of them by default, or the files given) in canonical form: keys in the order of the spec documentation, scripts as literal blocks, consistent quoting and indentation. Comments are kept. With --check, nothing is written, and the names of unformatted specs are printed instead.",
+		Run: func(cmd *cobra.Command, paths []string) {
+			check, err := cmd.Flags().GetBool("check")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --check")
+			}
+
+			if len(paths) == 0 {
+				paths, err = hammer.NewLoader(viper.GetString("search")).SpecPaths()
+				if err != nil {
+					logrus.WithError(err).Fatal("could not find specs")
+				}
+			}
+
+			unformatted := false
+			for _, path := range paths {
+				logger := logrus.WithField("path", path)
+				if ext := filepath.Ext(path); ext != ".yml" && ext != ".yaml" {
+					logger.Info("only YAML specs are formatted, skipping")
+					continue
+				}
+
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					logger.WithError(err).Fatal("could not read spec")
+				}
+
+				formatted, err := hammer.Format(content)
+				if err != nil {
+					logger.WithError(err).Fatal("could not format spec")
+				}
+
+				if bytes.Equal(content, formatted) {
+					continue
+				}
+				unformatted = true
+
+				if check {
+					fmt.Println(path)
+					continue
+				}
+
+				info, err := os.Stat(path)
+				if err != nil {
+					logger.WithError(err).Fatal("could not read spec")
+				}
+
+				err = ioutil.WriteFile(path, formatted, info.Mode().Perm())
+				if err != nil {
+					logger.WithError(err).Fatal("could not write spec")
+				}
+				logger.Info("formatted spec")
+			}
+
+			if check && unformatted {
+				os.Exit(1)
+			}
+		},
+	}
+)
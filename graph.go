@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	graphCmd = &cobra.Command{
+		Use:   "graph",
+		Short: "show how packages relate to each other",
+		Long:  "print the packages, their multi, matrix and subpackage children, and the dependencies between them as a graph. Dependencies on packages that aren't loaded, and dependency cycles, are highlighted.",
+		Run: func(cmd *cobra.Command, args []string) {
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --format")
+			}
+
+			loader := hammer.NewLoader(viper.GetString("search"))
+			loader.Overrides = overrides(cmd)
+			loaded, err := loader.Load()
+			if err != nil {
+				logrus.WithField("error", err).Fatal("could not load packages")
+			}
+
+			graph, err := hammer.NewGraph(loaded)
+			if err != nil {
+				logrus.WithError(err).Fatal("could not build graph")
+			}
+
+			for _, cycle := range graph.Cycles() {
+				logrus.WithField("packages", strings.Join(cycle, ", ")).Warn("dependency cycle")
+			}
+
+			switch format {
+			case "dot":
+				fmt.Print(graph.Dot())
+			case "mermaid":
+				fmt.Print(graph.Mermaid())
+			case "tree":
+				fmt.Print(graph.Tree())
+			default:
+				logrus.WithField("format", format).Fatal("unknown format (try dot, mermaid or tree)")
+			}
+		},
+	}
+)
@@ -0,0 +1,227 @@
+package hammer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Artifact is a single file produced by packaging
+type Artifact struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewArtifact checksums the file at the given path
+func NewArtifact(name string) (Artifact, error) {
+	artifact := Artifact{Path: name}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return artifact, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return artifact, err
+	}
+	artifact.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	return artifact, nil
+}
+
+// Manifest is written next to the packages in OutputRoot, so that other tools
+// (and later runs of Hammer) can find out what was built. The manifest file
+// holds a list with one Manifest for each variant of the package.
+type Manifest struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Iteration    string            `json:"iteration,omitempty"`
+	Epoch        string            `json:"epoch,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Architecture string            `json:"architecture,omitempty"`
+	Matrix       map[string]string `json:"matrix,omitempty"`
+	Artifacts    []Artifact        `json:"artifacts"`
+}
+
+// ManifestPath is the location of the manifest for this package in
+// OutputRoot, named "name-version.json". Variants of the package (matrix
+// children, architectures and types) share the file, each with its own entry.
+func (p *Package) ManifestPath() (string, error) {
+	name, err := p.template.RenderField("name", p.Name)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := p.template.RenderField("version", p.Version)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(p.OutputRoot, name.String()+"-"+version.String()+".json"), nil
+}
+
+// sameVariant tells whether two manifests describe the same variant of a
+// package, and so belong in the same entry of the manifest file
+func (m *Manifest) sameVariant(other *Manifest) bool {
+	if m.Name != other.Name || m.Type != other.Type || m.Architecture != other.Architecture {
+		return false
+	}
+	if len(m.Matrix) != len(other.Matrix) {
+		return false
+	}
+	for key, value := range m.Matrix {
+		if otherValue, ok := other.Matrix[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// manifestLock guards the manifest files, which are shared by variants that
+// may be built at the same time
+var manifestLock sync.Mutex
+
+// readManifests reads every entry in the manifest file at dest
+func readManifests(dest string) ([]*Manifest, error) {
+	content, err := ioutil.ReadFile(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*Manifest{}
+	err = json.Unmarshal(content, &manifests)
+	return manifests, err
+}
+
+// manifest builds a Manifest from the rendered package fields
+func (p *Package) manifest() (*Manifest, error) {
+	m := &Manifest{Matrix: p.Matrix, Artifacts: p.Artifacts}
+
+	type field struct {
+		name string
+		raw  string
+		dest *string
+	}
+	fields := []field{
+		{"name", p.Name, &m.Name},
+		{"version", p.Version, &m.Version},
+		{"iteration", p.Iteration, &m.Iteration},
+		{"epoch", p.Epoch, &m.Epoch},
+		{"type", p.Type, &m.Type},
+		{"architecture", p.Architecture, &m.Architecture},
+	}
+	for _, field := range fields {
+		rendered, err := p.template.RenderField(field.name, field.raw)
+		if err != nil {
+			return nil, err
+		}
+		*field.dest = rendered.String()
+	}
+
+	return m, nil
+}
+
+// WriteManifest writes the manifest for the current Artifacts, replacing the
+// entry left by a previous build of the same variant
+func (p *Package) WriteManifest() error {
+	m, err := p.manifest()
+	if err != nil {
+		p.logger.WithError(err).Error("could not render manifest")
+		return err
+	}
+
+	dest, err := p.ManifestPath()
+	if err != nil {
+		return err
+	}
+
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+
+	manifests, err := readManifests(dest)
+	if err != nil && !os.IsNotExist(err) {
+		p.logger.WithFields(logrus.Fields{
+			"error": err,
+			"path":  dest,
+		}).Error("could not read manifest")
+		return err
+	}
+
+	replaced := false
+	for i, existing := range manifests {
+		if existing.sameVariant(m) {
+			manifests[i] = m
+			replaced = true
+		}
+	}
+	if !replaced {
+		manifests = append(manifests, m)
+	}
+
+	content, err := json.MarshalIndent(manifests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(dest, content, 0644)
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"error": err,
+			"path":  dest,
+		}).Error("could not write manifest")
+	}
+	return err
+}
+
+// ReadManifest reads the manifest entry left by a previous build of this
+// variant, if there is one. It returns an error satisfying os.IsNotExist if
+// the variant has not been built yet.
+func (p *Package) ReadManifest() (*Manifest, error) {
+	variant, err := p.manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	dest, err := p.ManifestPath()
+	if err != nil {
+		return nil, err
+	}
+
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+
+	manifests, err := readManifests(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range manifests {
+		if m.sameVariant(variant) {
+			return m, nil
+		}
+	}
+
+	return nil, &os.PathError{Op: "read", Path: dest, Err: os.ErrNotExist}
+}
+
+// LoadArtifacts sets Artifacts from a previous build's manifest, if present.
+func (p *Package) LoadArtifacts() error {
+	m, err := p.ReadManifest()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	p.Artifacts = m.Artifacts
+	return nil
+}
@@ -0,0 +1,92 @@
+package hammer
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestPath(t *testing.T) {
+	variant := func(typ, arch string, matrix map[string]string) *Package {
+		p := NewPackage()
+		p.Name = "consul"
+		p.Version = "0.5.2"
+		p.Type = typ
+		p.Architecture = arch
+		p.Matrix = matrix
+		p.OutputRoot = "out"
+		return p
+	}
+
+	tests := []struct {
+		pkg      *Package
+		expected string
+	}{
+		{variant("", "", nil), "out/consul-0.5.2.json"},
+		{variant("rpm", "", nil), "out/consul-0.5.2.json"},
+		{variant("deb", "amd64", nil), "out/consul-0.5.2.json"},
+		{variant("rpm", "x86_64", map[string]string{"os": "el7", "go": "1.5"}), "out/consul-0.5.2.json"},
+	}
+
+	for _, test := range tests {
+		actual, err := test.pkg.ManifestPath()
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, actual)
+	}
+}
+
+func TestManifestVariants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-artifact-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	variant := func(typ, dist string) *Package {
+		p := NewPackage()
+		p.Name = "consul"
+		p.Version = "0.5.2"
+		p.Type = typ
+		p.Matrix = map[string]string{"os": dist}
+		p.OutputRoot = dir
+		return p
+	}
+
+	rpm := variant("rpm", "el7")
+	rpm.Iteration = "3"
+	rpm.Artifacts = []Artifact{{Path: "consul-0.5.2-3.el7.x86_64.rpm"}}
+	assert.Nil(t, rpm.WriteManifest())
+
+	deb := variant("deb", "el7")
+	deb.Iteration = "1"
+	deb.Artifacts = []Artifact{{Path: "consul_0.5.2-1_amd64.deb"}}
+	assert.Nil(t, deb.WriteManifest())
+
+	// another matrix value of the same type hasn't been built
+	_, err = variant("rpm", "el6").ReadManifest()
+	assert.True(t, os.IsNotExist(err))
+
+	m, err := variant("rpm", "el7").ReadManifest()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", m.Iteration)
+	assert.Equal(t, rpm.Artifacts, m.Artifacts)
+	assert.Equal(t, map[string]string{"os": "el7"}, m.Matrix)
+
+	m, err = variant("deb", "el7").ReadManifest()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", m.Iteration)
+	assert.Equal(t, deb.Artifacts, m.Artifacts)
+
+	// rebuilding a variant replaces its entry
+	rpm.Iteration = "4"
+	assert.Nil(t, rpm.WriteManifest())
+
+	manifests, err := readManifests(path.Join(dir, "consul-0.5.2.json"))
+	assert.Nil(t, err)
+	assert.Len(t, manifests, 2)
+
+	m, err = variant("rpm", "el7").ReadManifest()
+	assert.Nil(t, err)
+	assert.Equal(t, "4", m.Iteration)
+}
@@ -2,18 +2,38 @@ package hammer
 
 import (
 	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
 )
 
 var (
-	errBadValue     = errors.New("bad value")
-	errUnknownValue = errors.New("don't know how to handle value")
+	// ErrBadMergeStrategy is returned when a merge strategy is unknown, or
+	// can't be used for a field (like appending to a string.)
+	ErrBadMergeStrategy = errors.New("bad merge strategy")
+
+	// ErrUnknownMergeField is returned when a merge strategy is given for a
+	// field that does not exist.
+	ErrUnknownMergeField = errors.New("merge strategy given for unknown field")
 )
 
-// ExpandRecursive fills in inheritance for the Multi field
+// ExpandRecursive fills in inheritance for the Multi, Subpackages and Matrix
+// fields. Children that set their own version-from have it resolved here,
+// before their own children are created; the top level is resolved by the
+// caller.
 func (p *Package) ExpandRecursive(parent *Package) error {
 	p.Parent = parent // should be called with nil as a parent for the top level
 	p.Children = []*Package{}
 
+	if parent != nil && p.VersionFrom != parent.VersionFrom {
+		p.Version = "" // inherited, so not worth a warning
+		err := p.ResolveVersion()
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, sub := range p.Multi {
 		grandchild, err := p.expandSingle(sub)
 		if err != nil {
@@ -27,18 +47,76 @@ func (p *Package) ExpandRecursive(parent *Package) error {
 		}
 	}
 
+	// the parent of a matrix isn't built, so there's nothing to split. Its
+	// children will each have the subpackages instead.
+	if p.MatrixSpec.IsEmpty() {
+		for _, sub := range p.Subpackages {
+			grandchild, err := p.expandSubpackage(sub)
+			if err != nil {
+				return err
+			}
+
+			p.Children = append(p.Children, grandchild)
+			err = grandchild.ExpandRecursive(p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, combination := range p.MatrixSpec.Combinations() {
+		grandchild, err := p.expandMatrix(combination)
+		if err != nil {
+			return err
+		}
+
+		p.Children = append(p.Children, grandchild)
+		err = grandchild.ExpandRecursive(p)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// expandMatrix creates a child for a single combination of matrix values.
+// Unlike "multi" children, matrix children keep the build script, since the
+// parent of a matrix is never built itself.
+func (p *Package) expandMatrix(combination map[string]string) (*Package, error) {
+	child, err := p.expandSingle(new(Package))
+	if err != nil {
+		return child, err
+	}
+
+	if build, ok := p.Scripts["build"]; ok {
+		child.Scripts["build"] = build
+	}
+
+	child.Matrix = map[string]string{}
+	for k, v := range p.Matrix {
+		child.Matrix[k] = v
+	}
+	for k, v := range combination {
+		child.Matrix[k] = v
+	}
+	child.logger = child.logger.WithField("matrix", describeCombination(child.Matrix))
+
+	return child, nil
+}
+
 func (p *Package) expandSingle(child *Package) (*Package, error) {
 	base := NewPackage()
 	tmpl := base.template
+	tmpl.Strict = p.template.Strict
 
 	// copy fields
 	*base = *p
 
 	// reset fields we should never inherit
 	base.Multi = []*Package{}
+	base.MatrixSpec = Matrix{}
+	base.SharedBuild = false
 	base.template = tmpl
 
 	scripts := Scripts{}
@@ -53,7 +131,7 @@ func (p *Package) expandSingle(child *Package) (*Package, error) {
 	base.Scripts = scripts
 
 	// copy fields
-	err := base.copyFieldsFrom(child)
+	err := base.mergeFrom(child)
 	if err != nil {
 		return base, err
 	}
@@ -64,91 +142,221 @@ func (p *Package) expandSingle(child *Package) (*Package, error) {
 	return base, nil
 }
 
-func (p *Package) copyFieldsFrom(other *Package) error {
-	// single-value fields
-	type Field struct {
-		other interface{}
-		p     interface{}
-	}
-	fields := []Field{
-		{other.Architecture, &p.Architecture},
-		{other.Depends, &p.Depends},
-		{other.Description, &p.Description},
-		{other.Epoch, &p.Epoch},
-		{other.ExtraArgs, &p.ExtraArgs},
-		{other.Iteration, &p.Iteration},
-		{other.License, &p.License},
-		{other.Multi, &p.Multi},
-		{other.Name, &p.Name},
-		{other.Resources, &p.Resources},
-		{other.Scripts, &p.Scripts},
-		{other.Targets, &p.Targets},
-		{other.Type, &p.Type},
-		{other.URL, &p.URL},
-		{other.Vendor, &p.Vendor},
-		{other.Version, &p.Version},
-	}
-	for _, field := range fields {
-		switch value := field.other.(type) {
-		case string: // basic values
-			if value != "" {
-				target, ok := field.p.(*string)
-				if !ok {
-					return errBadValue
-				}
-				*target = value
-			}
+// merge strategies, selectable per field with the "merge" key in a spec
+const (
+	// MergeReplace uses the inherited value unless a new one is set. It is the
+	// default for everything but maps and nested structures.
+	MergeReplace = "replace"
 
-		case []string: // dependencies
-			if len(value) != 0 {
-				target, ok := field.p.(*[]string)
-				if !ok {
-					return errBadValue
-				}
-				*target = value
+	// MergeAppend adds new list items after the inherited ones.
+	MergeAppend = "append"
+
+	// MergeDeep merges maps key by key (recursively, for maps inside vars) and
+	// structures field by field. It is the default for maps and structures.
+	MergeDeep = "deep-merge"
+)
+
+// yamlField is a struct field that can be set from YAML
+type yamlField struct {
+	Name  string
+	Index int
+}
+
+// yamlFields lists the fields of a struct type that are read from YAML, in
+// declaration order
+func yamlFields(t reflect.Type) []yamlField {
+	fields := []yamlField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields = append(fields, yamlField{name, i})
+	}
+
+	return fields
+}
+
+// mergeFrom merges every YAML field set in other into p. The strategy for
+// each field comes from the Merge settings of other, then p, then the default
+// for the kind of field.
+func (p *Package) mergeFrom(other *Package) error {
+	strategies := map[string]string{}
+	for name, strategy := range p.Merge {
+		strategies[name] = strategy
+	}
+	for name, strategy := range other.Merge {
+		strategies[name] = strategy
+	}
+
+	dest := reflect.ValueOf(p).Elem()
+	src := reflect.ValueOf(other).Elem()
+
+	known := map[string]bool{}
+	for _, field := range yamlFields(dest.Type()) {
+		known[field.Name] = true
+
+		err := mergeValue(dest.Field(field.Index), src.Field(field.Index), strategies[field.Name])
+		if err != nil {
+			p.logger.WithFields(logrus.Fields{
+				"field":    field.Name,
+				"strategy": strategies[field.Name],
+			}).Error(err)
+			return err
+		}
+	}
+
+	for name := range strategies {
+		if !known[name] {
+			p.logger.WithField("field", name).Error(ErrUnknownMergeField)
+			return ErrUnknownMergeField
+		}
+	}
+
+	return nil
+}
+
+func mergeValue(dest, src reflect.Value, strategy string) error {
+	if strategy == "" {
+		strategy = MergeReplace
+		if dest.Kind() == reflect.Map || dest.Kind() == reflect.Struct {
+			strategy = MergeDeep
+		}
+	}
+
+	switch strategy {
+	case MergeReplace:
+		if !isEmptyValue(src) {
+			dest.Set(cloneValue(src))
+		}
+
+	case MergeAppend:
+		if dest.Kind() != reflect.Slice {
+			return ErrBadMergeStrategy
+		}
+		if src.Len() == 0 {
+			return nil
+		}
+
+		merged := reflect.MakeSlice(dest.Type(), 0, dest.Len()+src.Len())
+		merged = reflect.AppendSlice(merged, dest)
+		merged = reflect.AppendSlice(merged, src)
+		dest.Set(merged)
+
+	case MergeDeep:
+		switch dest.Kind() {
+		case reflect.Map:
+			if src.Len() == 0 {
+				return nil
 			}
+			dest.Set(mergeMaps(dest, src))
 
-		case []Resource:
-			if len(value) != 0 {
-				target, ok := field.p.(*[]Resource)
-				if !ok {
-					return errBadValue
-				}
-				*target = value
+		case reflect.Struct:
+			// version-from sources are alternatives, so a new one replaces the
+			// inherited one instead of being merged with it
+			if from, ok := src.Interface().(VersionFrom); ok && from.hasSource() {
+				inherited := dest.Interface().(VersionFrom)
+				dest.Set(reflect.ValueOf(VersionFrom{Format: inherited.Format}))
 			}
 
-		case []Target:
-			if len(value) != 0 {
-				target, ok := field.p.(*[]Target)
-				if !ok {
-					return errBadValue
+			for i := 0; i < dest.NumField(); i++ {
+				if dest.Type().Field(i).PkgPath != "" {
+					continue
 				}
-				*target = value
-			}
 
-		case []*Package:
-			if len(value) != 0 {
-				target, ok := field.p.(*[]*Package)
-				if !ok {
-					return errBadValue
+				err := mergeValue(dest.Field(i), src.Field(i), "")
+				if err != nil {
+					return err
 				}
-				*target = value
 			}
 
-		case Scripts:
-			target, ok := field.p.(*Scripts)
-			if !ok {
-				return errBadValue
-			}
+		default:
+			return ErrBadMergeStrategy
+		}
+
+	default:
+		return ErrBadMergeStrategy
+	}
+
+	return nil
+}
+
+// mergeMaps returns a new map with the keys of both maps. When both hold a
+// map under the same key (as untyped YAML values can), those are merged too.
+func mergeMaps(dest, src reflect.Value) reflect.Value {
+	merged := reflect.MakeMap(dest.Type())
+
+	for _, key := range dest.MapKeys() {
+		merged.SetMapIndex(key, dest.MapIndex(key))
+	}
+
+	for _, key := range src.MapKeys() {
+		value := src.MapIndex(key)
 
-			for name, script := range value {
-				(*target)[name] = script
+		existing := merged.MapIndex(key)
+		if existing.IsValid() {
+			inner, innerExisting := value, existing
+			for inner.Kind() == reflect.Interface && !inner.IsNil() {
+				inner = inner.Elem()
+			}
+			for innerExisting.Kind() == reflect.Interface && !innerExisting.IsNil() {
+				innerExisting = innerExisting.Elem()
 			}
 
-		default:
-			return errUnknownValue
+			if inner.Kind() == reflect.Map && innerExisting.Kind() == reflect.Map && inner.Type() == innerExisting.Type() {
+				value = mergeMaps(innerExisting, inner)
+			}
 		}
+
+		merged.SetMapIndex(key, value)
 	}
 
-	return nil
+	return merged
+}
+
+// cloneValue copies slices and maps so that merged packages never share them
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Slice:
+		return reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v)
+	case reflect.Map:
+		return mergeMaps(reflect.MakeMap(v.Type()), v)
+	default:
+		return v
+	}
+}
+
+// isEmptyValue reports whether a value was left unset in the spec
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && !isEmptyValue(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
 }
@@ -0,0 +1,213 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeFrom(t *testing.T) {
+	cases := []struct {
+		name   string
+		base   string
+		child  string
+		expect func(*testing.T, *Package)
+		err    error
+	}{
+		{
+			name:  "scalars are replaced when set",
+			base:  "name: base\nversion: 1.0.0\nvendor: Asteris",
+			child: "name: child\nvendor: ''",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, "child", p.Name)
+				assert.Equal(t, "1.0.0", p.Version)
+				assert.Equal(t, "Asteris", p.Vendor)
+			},
+		},
+		{
+			name:  "lists are replaced by default",
+			base:  "depends: [a, b]\nobsoletes: [old]",
+			child: "depends: [c]",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, []string{"c"}, p.Depends)
+				assert.Equal(t, []string{"old"}, p.Obsoletes)
+			},
+		},
+		{
+			name:  "attrs are inherited and replaced",
+			base:  "attrs: [{file: /a, mode: '755'}]",
+			child: "attrs: [{file: /b}]",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, []Attr{{File: "/b"}}, p.Attrs)
+			},
+		},
+		{
+			name:  "lists can be appended",
+			base:  "depends: [a, b]",
+			child: "depends: [c]\nmerge: {depends: append}",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, []string{"a", "b", "c"}, p.Depends)
+			},
+		},
+		{
+			name:  "strategies set on the parent apply to children",
+			base:  "depends: [a]\nmerge: {depends: append}",
+			child: "depends: [b]",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, []string{"a", "b"}, p.Depends)
+			},
+		},
+		{
+			name:  "maps are deep-merged by default",
+			base:  "vars: {a: '1', b: '2'}\nscripts: {before-install: one, after-install: two}",
+			child: "vars: {b: '3'}\nscripts: {after-install: three}",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, Vars{"a": "1", "b": "3"}, p.Vars)
+				assert.Equal(t, Scripts{"before-install": "one", "after-install": "three"}, p.Scripts)
+			},
+		},
+		{
+			name:  "nested vars are deep-merged",
+			base:  "vars: {urls: {x86_64: a, i386: b}, plugins: [x]}",
+			child: "vars: {urls: {i386: c}}",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, Vars{
+					"urls":    map[string]interface{}{"x86_64": "a", "i386": "c"},
+					"plugins": []interface{}{"x"},
+				}, p.Vars)
+			},
+		},
+		{
+			name:  "maps can be replaced",
+			base:  "vars: {a: '1', b: '2'}",
+			child: "vars: {b: '3'}\nmerge: {vars: replace}",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, Vars{"b": "3"}, p.Vars)
+			},
+		},
+		{
+			name:  "structures are merged field by field",
+			base:  "verify: {contains: [/a], excludes: [/b]}",
+			child: "verify: {contains: [/c]}",
+			expect: func(t *testing.T, p *Package) {
+				assert.Equal(t, []string{"/c"}, p.Verification.Contains)
+				assert.Equal(t, []string{"/b"}, p.Verification.Excludes)
+			},
+		},
+		{
+			name:  "unknown strategies are an error",
+			child: "merge: {depends: shuffle}",
+			err:   ErrBadMergeStrategy,
+		},
+		{
+			name:  "strategies must fit the field",
+			child: "name: x\nmerge: {name: append}",
+			err:   ErrBadMergeStrategy,
+		},
+		{
+			name:  "strategies must name a field",
+			child: "merge: {nope: replace}",
+			err:   ErrUnknownMergeField,
+		},
+	}
+
+	for _, c := range cases {
+		base, err := NewPackageFromYAML([]byte(c.base))
+		assert.Nil(t, err, c.name)
+		child, err := NewPackageFromYAML([]byte(c.child))
+		assert.Nil(t, err, c.name)
+
+		err = base.mergeFrom(child)
+		if c.err != nil {
+			assert.Equal(t, c.err, err, c.name)
+			continue
+		}
+		assert.Nil(t, err, c.name)
+
+		t.Logf("checking %s", c.name)
+		c.expect(t, base)
+	}
+}
+
+func TestExpandDoesNotShareWithParent(t *testing.T) {
+	parent, err := NewPackageFromYAML([]byte(`
+name: parent
+depends: [a]
+vars: {a: '1'}
+scripts: {build: make, after-install: one}
+merge: {depends: append}
+multi:
+  - name: child
+    depends: [b]
+    vars: {b: '2'}
+    scripts: {after-install: two}
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, parent.ExpandRecursive(nil))
+
+	child := parent.Children[0]
+	assert.Equal(t, []string{"a", "b"}, child.Depends)
+	assert.Equal(t, Scripts{"after-install": "two"}, child.Scripts)
+
+	child.Scripts["after-install"] = "changed"
+	child.Vars["a"] = "changed"
+	child.Depends[0] = "changed"
+
+	assert.Equal(t, Scripts{"build": "make", "after-install": "one"}, parent.Scripts)
+	assert.Equal(t, Vars{"a": "1"}, parent.Vars)
+	assert.Equal(t, []string{"a"}, parent.Depends)
+}
+
+func TestSharedBuild(t *testing.T) {
+	parent, err := NewPackageFromYAML([]byte(`
+name: foo
+multi:
+  - name: foo-doc
+    shared-build: true
+  - name: foo-devel
+    shared-build: true
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, parent.ExpandRecursive(nil))
+
+	assert.Nil(t, parent.Setup())
+	for _, child := range parent.Children {
+		assert.Nil(t, child.Setup())
+		assert.Equal(t, parent.BuildRoot, child.BuildRoot)
+	}
+
+	// the build root stays until the last package using it is cleaned up
+	assert.Nil(t, parent.Cleanup())
+	assert.Nil(t, parent.Children[0].Cleanup())
+	assert.DirExists(t, parent.BuildRoot)
+
+	assert.Nil(t, parent.Children[1].Cleanup())
+	assert.NoDirExists(t, parent.BuildRoot)
+}
+
+func TestSharedBuildWithoutParent(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		pkg  func(*Package) *Package
+	}{
+		{
+			name: "top level",
+			spec: "name: foo\nshared-build: true",
+			pkg:  func(p *Package) *Package { return p },
+		},
+		{
+			name: "matrix parents don't build",
+			spec: "name: foo\nmatrix: {arch: [amd64]}\nmulti: [{name: foo-doc, shared-build: true}]",
+			pkg:  func(p *Package) *Package { return p.Children[0] },
+		},
+	}
+
+	for _, c := range cases {
+		p, err := NewPackageFromYAML([]byte(c.spec))
+		assert.Nil(t, err, c.name)
+		assert.Nil(t, p.ExpandRecursive(nil), c.name)
+
+		assert.Equal(t, ErrNoSharedBuild, c.pkg(p).Setup(), c.name)
+	}
+}
@@ -0,0 +1,220 @@
+package hammer
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatIndent is the indentation used by Format
+const FormatIndent = 2
+
+var scriptsType = reflect.TypeOf(Scripts{})
+
+// Format rewrites a spec in canonical form, keeping comments: keys are
+// ordered as the fields of Package (and of the structures inside it), with
+// unknown keys last; scalars are only quoted where YAML 1.1 needs it; scripts
+// are written as literal blocks; and everything is in block style, indented
+// by FormatIndent. A top-level key that had a blank line before it (or before
+// its comments) still does, wherever it moves to.
+func Format(content []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return content, nil
+	}
+
+	// a comment at the top of the spec stays there, even if the key below it
+	// moves
+	var top string
+	root := doc.Content[0]
+	if root.Kind == yaml.MappingNode && len(root.Content) > 0 {
+		top, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	spaced := spacedKeys(content, root)
+
+	formatNode(&doc, reflect.TypeOf(Package{}))
+
+	if top != "" {
+		first := root.Content[0]
+		first.HeadComment = strings.TrimSpace(top + "\n" + first.HeadComment)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(FormatIndent)
+	err = encoder.Encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return addBlankLines(buf.Bytes(), root, spaced), nil
+}
+
+// spacedKeys finds the top-level keys of a spec that have a blank line above
+// them, or above the comments directly on top of them
+func spacedKeys(content []byte, root *yaml.Node) map[*yaml.Node]bool {
+	spaced := map[*yaml.Node]bool{}
+	if root.Kind != yaml.MappingNode {
+		return spaced
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i := 2; i < len(root.Content); i += 2 {
+		key := root.Content[i]
+		above := key.Line - 2 // Line counts from one
+		for above >= 0 && strings.HasPrefix(strings.TrimSpace(lines[above]), "#") {
+			above--
+		}
+		if above >= 0 && strings.TrimSpace(lines[above]) == "" {
+			spaced[key] = true
+		}
+	}
+	return spaced
+}
+
+// addBlankLines puts a blank line above each spaced top-level key in the
+// formatted spec, and above any comments on top of it. Top-level keys are the
+// only lines that start with neither a space nor a comment, and are in the
+// same order as in root.
+func addBlankLines(formatted []byte, root *yaml.Node, spaced map[*yaml.Node]bool) []byte {
+	if len(spaced) == 0 {
+		return formatted
+	}
+
+	lines := strings.Split(string(formatted), "\n")
+	out := make([]string, 0, len(lines)+len(spaced))
+	key := 0
+	for _, line := range lines {
+		if line == "" || line[0] == ' ' || line[0] == '#' || line == "---" {
+			out = append(out, line)
+			continue
+		}
+
+		if key < len(root.Content) && spaced[root.Content[key]] {
+			comments := len(out)
+			for comments > 0 && strings.HasPrefix(out[comments-1], "#") {
+				comments--
+			}
+			if comments > 0 && out[comments-1] != "" {
+				out = append(out[:comments], append([]string{""}, out[comments:]...)...)
+			}
+		}
+		key += 2
+
+		out = append(out, line)
+	}
+
+	return []byte(strings.Join(out, "\n"))
+}
+
+// formatNode formats node in place. t is the type the node is read into, or
+// nil if it isn't known.
+func formatNode(node *yaml.Node, t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			formatNode(child, t)
+		}
+
+	case yaml.SequenceNode:
+		node.Style &^= yaml.FlowStyle
+
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		for _, child := range node.Content {
+			formatNode(child, elem)
+		}
+
+	case yaml.MappingNode:
+		node.Style &^= yaml.FlowStyle
+		formatMapping(node, t)
+
+	case yaml.ScalarNode:
+		if quoted := node.Style & (yaml.SingleQuotedStyle | yaml.DoubleQuotedStyle); quoted != 0 {
+			// the encoder adds quotes back where YAML 1.2 needs them, but specs
+			// are read as YAML 1.1, where words like "yes" and "off" are not
+			// strings, so those keep their quotes
+			node.Style = 0
+			if !readsAsString(node.Value) {
+				node.Style = quoted
+			}
+		}
+		if strings.Contains(strings.TrimRight(node.Value, "\n"), "\n") {
+			node.Style = yaml.LiteralStyle
+		}
+	}
+}
+
+// formatMapping orders the keys of a mapping for a struct type, and formats
+// the values
+func formatMapping(node *yaml.Node, t reflect.Type) {
+	type pair struct {
+		key, value *yaml.Node
+		rank       int
+	}
+
+	ranks := map[string]int{}
+	fieldTypes := map[string]reflect.Type{}
+	unknown := 0
+	if t != nil && t.Kind() == reflect.Struct {
+		unknown = t.NumField()
+		for _, field := range yamlFields(t) {
+			structField := t.Field(field.Index)
+			if strings.Contains(structField.Tag.Get("yaml"), ",inline") {
+				// keys of an inline map go where the map is declared
+				unknown = field.Index
+				continue
+			}
+			ranks[field.Name] = field.Index
+			fieldTypes[field.Name] = structField.Type
+		}
+	}
+
+	pairs := []pair{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		formatNode(key, nil)
+
+		valueType := fieldTypes[key.Value]
+		if t != nil && t.Kind() == reflect.Map {
+			valueType = t.Elem()
+		}
+
+		switch {
+		case t == scriptsType && value.Kind == yaml.ScalarNode:
+			value.Style = yaml.LiteralStyle
+		default:
+			formatNode(value, valueType)
+		}
+
+		rank, ok := ranks[key.Value]
+		if !ok {
+			rank = unknown
+		}
+		pairs = append(pairs, pair{key, value, rank})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].rank < pairs[j].rank })
+
+	node.Content = node.Content[:0]
+	for _, p := range pairs {
+		node.Content = append(node.Content, p.key, p.value)
+	}
+}
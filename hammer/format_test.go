@@ -0,0 +1,150 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFormat(t *testing.T) {
+	in := `# consul, packaged for CentOS
+
+version: "0.5.2" # from upstream
+name: 'consul'
+scripts: {build: make}
+targets:
+- dest: /usr/bin/
+  src: "{{.BuildRoot}}/consul"
+  mode: "0755"
+depends: [systemd]
+matrix:
+  exclude:
+  - os: el6
+  os: [el6, el7]
+custom: true
+`
+
+	out, err := Format([]byte(in))
+	assert.NoError(t, err)
+	assert.Equal(t, `# consul, packaged for CentOS
+
+depends:
+  - systemd
+name: consul
+scripts:
+  build: |-
+    make
+targets:
+  - src: "{{.BuildRoot}}/consul"
+    dest: /usr/bin/
+    mode: "0755"
+version: 0.5.2 # from upstream
+matrix:
+  os:
+    - el6
+    - el7
+  exclude:
+    - os: el6
+custom: true
+`, string(out))
+
+	again, err := Format(out)
+	assert.NoError(t, err)
+	assert.Equal(t, string(out), string(again))
+
+	original, err := NewPackageFromYAML([]byte(in))
+	assert.NoError(t, err)
+	formatted, err := NewPackageFromYAML(out)
+	assert.NoError(t, err)
+	assert.Equal(t, original.Targets, formatted.Targets)
+	assert.Equal(t, original.MatrixSpec, formatted.MatrixSpec)
+}
+
+func TestFormatKeepsBlankLines(t *testing.T) {
+	in := `name: consul
+version: 0.5.2
+
+# how to build it
+scripts:
+  build: |
+    make
+
+    make install
+
+targets:
+- src: consul
+  dest: /usr/bin/
+depends: [systemd]
+`
+
+	out, err := Format([]byte(in))
+	assert.NoError(t, err)
+	assert.Equal(t, `depends:
+  - systemd
+name: consul
+
+# how to build it
+scripts:
+  build: |
+    make
+
+    make install
+
+targets:
+  - src: consul
+    dest: /usr/bin/
+version: 0.5.2
+`, string(out))
+
+	again, err := Format(out)
+	assert.NoError(t, err)
+	assert.Equal(t, string(out), string(again))
+}
+
+func TestFormatKeepsMeaning(t *testing.T) {
+	in := `name: "consul"
+version: "1.10"
+description: "~"
+license: 'null'
+vendor: "yes"
+url: 'http://example.com'
+epoch: "0755"
+vars:
+  debug: "no"
+  ui: 'on'
+  tls: "off"
+  short: "y"
+  never: 'n'
+  released: "2016-01-02"
+  port: "8500"
+  plain: "plain"
+matrix:
+  answer: ["Y", "N", "true"]
+upstream:
+  github: "hashicorp/consul"
+  prereleases: false
+`
+
+	out, err := Format([]byte(in))
+	assert.NoError(t, err)
+
+	original, err := NewPackageFromYAML([]byte(in))
+	assert.NoError(t, err)
+	formatted, err := NewPackageFromYAML(out)
+	assert.NoError(t, err)
+
+	expected, err := yaml.Marshal(original)
+	assert.NoError(t, err)
+	actual, err := yaml.Marshal(formatted)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual), string(out))
+
+	// quotes that YAML 1.1 doesn't need are still dropped
+	for _, plain := range []string{"name: consul", "url: http://example.com", "plain: plain", "github: hashicorp/consul"} {
+		assert.Contains(t, string(out), plain)
+	}
+	for _, quoted := range []string{`description: "~"`, `license: 'null'`, `vendor: "yes"`, `ui: 'on'`, `never: 'n'`, `epoch: "0755"`} {
+		assert.Contains(t, string(out), quoted)
+	}
+}
@@ -26,6 +26,15 @@ type FPM struct {
 
 	baseOpts []string
 	baseArgs []string
+	mappings []targetMapping
+}
+
+// targetMapping is a single rendered src=dest pair handed to FPM, along with
+// the Target it came from.
+type targetMapping struct {
+	Src    string
+	Dest   string
+	Target Target
 }
 
 // NewFPM does all necessary setup to run an FPM instance
@@ -81,81 +90,68 @@ func (f *FPM) PackageFor(outType string) (string, error) {
 
 func (f *FPM) setBaseArgs() error {
 	args := []string{}
+	mappings := []targetMapping{}
 
 	p := f.Package
 
 	// targets
-	for i, target := range p.Targets {
-		srcBuf, err := p.template.Render(target.Src)
+	for i, target := range p.allTargets() {
+		srcBuf, err := p.template.RenderField(fmt.Sprintf("targets[%d].src", i), target.Src)
 		if err != nil {
-			p.logger.WithField("index", i).Error("error templating target source name")
+			p.logger.WithFields(logrus.Fields{
+				"index": i,
+				"error": err,
+			}).Error("error templating target source name")
 			return err
 		}
 		src := srcBuf.String()
 
-		dest, err := p.template.Render(target.Dest)
+		dest, err := p.template.RenderField(fmt.Sprintf("targets[%d].dest", i), target.Dest)
 		if err != nil {
-			p.logger.WithField("index", i).Error("error templating target destination")
+			p.logger.WithFields(logrus.Fields{
+				"index": i,
+				"error": err,
+			}).Error("error templating target destination")
 			return err
 		}
 
-		// opt-in templating. We don't want to template *every* file because some
-		// things look like Go templates and aren't (see for example every other
-		// kind of mustache template)
-		if !target.Template {
-			args = append(args, src+"="+dest.String())
-		} else {
-			var content []byte
-			rawContent, err := ioutil.ReadFile(src)
-			if err != nil {
-				p.logger.WithFields(logrus.Fields{
-					"name":  src,
-					"error": err,
-				}).Error("error reading content")
-				return err
-			}
-
-			contentBuf, err := p.template.Render(string(rawContent))
-			if err != nil {
-				p.logger.WithFields(logrus.Fields{
-					"name":  src,
-					"error": err,
-				}).Error("error templating content")
-				return err
-			}
-			content = contentBuf.Bytes()
+		expanded, err := f.expandTarget(i, target, src, dest.String())
+		if err != nil {
+			return err
+		}
 
-			_, name := path.Split(src)
-			contentDest := path.Join(p.TargetRoot, name)
-			err = ioutil.WriteFile(contentDest, content, 0777)
+		for j, raw := range expanded {
+			mapping, err := f.stageTarget(fmt.Sprintf("%d-%d", i, j), target, raw.Src, raw.Dest)
 			if err != nil {
-				p.logger.WithFields(logrus.Fields{
-					"name":  src,
-					"error": err,
-				}).Error("error writing content")
 				return err
 			}
-
-			args = append(args, contentDest+"="+dest.String())
+			mappings = append(mappings, mapping)
 		}
 	}
 
+	for _, mapping := range mappings {
+		args = append(args, mapping.Src+"="+mapping.Dest)
+	}
+
 	f.baseArgs = args
+	f.mappings = mappings
 	return nil
 }
 
 func (f *FPM) setBaseOpts() error {
 	var opts []string
 
-	if len(f.Package.Targets) == 0 {
+	// packages are written to the staging root first, so that we know exactly
+	// which files FPM produced before moving them into OutputRoot
+	if len(f.Package.allTargets()) == 0 {
 		opts = []string{
 			"-s", "empty",
-			"-p", f.Package.OutputRoot,
+			"-p", f.Package.StagingRoot,
 		}
 	} else {
 		opts = []string{
 			"-s", "dir",
-			"-p", f.Package.OutputRoot,
+			"-p", f.Package.StagingRoot,
 		}
 	}
 
@@ -228,7 +224,7 @@ func (f *FPM) baseFields() ([]string, error) {
 			}
 		}
 
-		templated, err := f.Package.template.Render(field.Value)
+		templated, err := f.Package.template.RenderField(field.Name, field.Value)
 		if err != nil {
 			f.Package.logger.WithFields(logrus.Fields{
 				"field": field.Name,
@@ -247,7 +243,7 @@ func (f *FPM) baseDependencies() ([]string, error) {
 	opts := []string{}
 
 	for _, rawDepend := range f.Package.Depends {
-		depend, err := f.Package.template.Render(rawDepend)
+		depend, err := f.Package.template.RenderField("depends", rawDepend)
 		if err != nil {
 			f.Package.logger.WithFields(logrus.Fields{
 				"error": err,
@@ -265,7 +261,7 @@ func (f *FPM) baseObsoletes() ([]string, error) {
 	opts := []string{}
 
 	for _, rawObsolete := range f.Package.Obsoletes {
-		obsolete, err := f.Package.template.Render(rawObsolete)
+		obsolete, err := f.Package.template.RenderField("obsoletes", rawObsolete)
 		if err != nil {
 			f.Package.logger.WithFields(logrus.Fields{
 				"error": err,
@@ -282,12 +278,21 @@ func (f *FPM) baseObsoletes() ([]string, error) {
 func (f *FPM) baseScripts() ([]string, error) {
 	opts := []string{}
 
+	err := f.appendScript("after-install", f.ownershipScript(f.Package.Type))
+	if err != nil {
+		return opts, err
+	}
+
 	for name, location := range f.Package.scriptLocations {
 		if name == "build" {
 			continue
 		}
 
-		if name != "before-install" && name != "after-install" && name != "before-remove" && name != "after-remove" && name != "before-upgrade" && name != "after-upgrade" {
+		known := false
+		for _, script := range ScriptNames {
+			known = known || name == script
+		}
+		if !known {
 			f.Package.logger.WithFields(logrus.Fields{
 				"script": name,
 			}).Error(ErrInvalidScriptName)
@@ -300,17 +305,60 @@ func (f *FPM) baseScripts() ([]string, error) {
 	return opts, nil
 }
 
+// appendScript adds generated content to the end of a script that was
+// already rendered to disk during Setup, or creates the script if there was
+// none.
+func (f *FPM) appendScript(name, content string) error {
+	p := f.Package
+	if content == "" {
+		return nil
+	}
+
+	scripts := Scripts{}
+	if location, ok := p.scriptLocations[name]; ok {
+		existing, err := ioutil.ReadFile(location)
+		if err != nil {
+			p.logger.WithFields(logrus.Fields{
+				"name":  name,
+				"error": err,
+			}).Error("could not read script from disk")
+			return err
+		}
+		scripts[name] = string(existing)
+	}
+	scripts.Append(name, content)
+
+	dest := path.Join(p.ScriptRoot, name)
+	err := ioutil.WriteFile(dest, []byte(scripts[name]), 0777)
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"name":  name,
+			"error": err,
+		}).Error("could not write script to disk")
+		return err
+	}
+
+	if p.scriptLocations == nil {
+		p.scriptLocations = map[string]string{}
+	}
+	p.scriptLocations[name] = dest
+	return nil
+}
+
 func (f *FPM) baseConfigs() ([]string, error) {
 	opts := []string{}
 
-	for i, target := range f.Package.Targets {
+	for i, target := range f.Package.allTargets() {
 		if !target.Config {
 			continue
 		}
 
-		dest, err := f.Package.template.Render(target.Dest)
+		dest, err := f.Package.template.RenderField(fmt.Sprintf("targets[%d].dest", i), target.Dest)
 		if err != nil {
-			f.Package.logger.WithField("index", i).Error("error templating target destination")
+			f.Package.logger.WithFields(logrus.Fields{
+				"index": i,
+				"error": err,
+			}).Error("error templating target destination")
 			return opts, err
 		}
 
@@ -323,7 +371,7 @@ func (f *FPM) baseConfigs() ([]string, error) {
 func (f *FPM) baseAttrs() ([]string, error) {
 	opts := []string{}
 
-	for _, attr := range f.Package.Attrs {
+	for _, attr := range append(f.targetAttrs(), f.Package.Attrs...) {
 		if attr.File == "" {
 			f.Package.logger.Debugf("Ignoring empty file")
 			continue
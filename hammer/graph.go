@@ -0,0 +1,348 @@
+package hammer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph holds the relationships between packages: the parents and children
+// created by expansion, and the dependencies between packages in Depends.
+// Every package is its own node, since children can share a name with their
+// parent or each other, so nodes are identified by IDs and Labels holds the
+// rendered name (and matrix values) to show for each. A dependency points at
+// the first package loaded with the name it gives.
+type Graph struct {
+	Roots    []string
+	Nodes    []string
+	Labels   map[string]string
+	Children map[string][]string
+	Depends  map[string][]string
+
+	// Unresolved holds the IDs of dependencies that name no loaded package.
+	// They are not in Nodes.
+	Unresolved map[string]bool
+
+	// cycle holds the dependency edges that are part of a cycle
+	cycle map[[2]string]bool
+}
+
+// NewGraph builds a Graph from the given top-level packages and their children
+func NewGraph(pkgs []*Package) (*Graph, error) {
+	g := &Graph{
+		Roots:      []string{},
+		Nodes:      []string{},
+		Labels:     map[string]string{},
+		Children:   map[string][]string{},
+		Depends:    map[string][]string{},
+		Unresolved: map[string]bool{},
+	}
+
+	ids := map[*Package]string{}
+	byName := map[string]string{}
+	for i, pkg := range Flatten(pkgs) {
+		name, err := pkg.template.RenderField("name", pkg.Name)
+		if err != nil {
+			return g, err
+		}
+
+		id := fmt.Sprintf("n%d", i)
+		ids[pkg] = id
+		g.Nodes = append(g.Nodes, id)
+
+		g.Labels[id] = name.String()
+		if len(pkg.Matrix) > 0 {
+			g.Labels[id] += " [" + describeCombination(pkg.Matrix) + "]"
+		}
+
+		if _, ok := byName[name.String()]; !ok {
+			byName[name.String()] = id
+		}
+	}
+
+	for _, pkg := range pkgs {
+		g.Roots = appendUnique(g.Roots, ids[pkg])
+	}
+
+	unresolved := map[string]string{}
+	for _, pkg := range Flatten(pkgs) {
+		id := ids[pkg]
+
+		for _, child := range pkg.Children {
+			g.Children[id] = appendUnique(g.Children[id], ids[child])
+		}
+
+		for _, raw := range pkg.Depends {
+			depend, err := pkg.template.RenderField("depends", raw)
+			if err != nil {
+				return g, err
+			}
+
+			name := dependName(depend.String())
+			if name == "" {
+				continue
+			}
+
+			target, ok := byName[name]
+			if !ok {
+				target, ok = unresolved[name]
+				if !ok {
+					target = fmt.Sprintf("u%d", len(unresolved))
+					unresolved[name] = target
+					g.Labels[target] = name
+					g.Unresolved[target] = true
+				}
+			}
+			g.Depends[id] = appendUnique(g.Depends[id], target)
+		}
+	}
+
+	g.findCycles()
+	return g, nil
+}
+
+// dependName returns the package name from a dependency like "foo >= 1.0" or
+// "foo(>=1.0)"
+func dependName(depend string) string {
+	depend = strings.TrimSpace(depend)
+	if i := strings.IndexAny(depend, " \t<>=("); i >= 0 {
+		depend = depend[:i]
+	}
+	return depend
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+// InCycle reports whether the dependency from one node on another is part of
+// a dependency cycle
+func (g *Graph) InCycle(from, to string) bool {
+	return g.cycle[[2]string{from, to}]
+}
+
+// Cycles returns the dependency cycles in the graph, as sorted lists of node
+// labels
+func (g *Graph) Cycles() [][]string {
+	cycles := [][]string{}
+	for _, component := range g.components() {
+		if len(component) > 1 || g.InCycle(component[0], component[0]) {
+			labels := []string{}
+			for _, node := range component {
+				labels = append(labels, g.Labels[node])
+			}
+			sort.Strings(labels)
+			cycles = append(cycles, labels)
+		}
+	}
+	return cycles
+}
+
+// findCycles marks every dependency edge inside a strongly connected component
+func (g *Graph) findCycles() {
+	g.cycle = map[[2]string]bool{}
+
+	component := map[string]int{}
+	for i, members := range g.components() {
+		for _, member := range members {
+			component[member] = i
+		}
+	}
+
+	for from, targets := range g.Depends {
+		for _, to := range targets {
+			if g.Unresolved[to] {
+				continue
+			}
+			if component[from] == component[to] {
+				g.cycle[[2]string{from, to}] = true
+			}
+		}
+	}
+}
+
+// components finds the strongly connected components of the dependency graph
+// with Tarjan's algorithm. Members of each component are in the order they
+// were found.
+func (g *Graph) components() [][]string {
+	index := 0
+	indices := map[string]int{}
+	lowlinks := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	components := [][]string{}
+
+	var connect func(string)
+	connect = func(node string) {
+		indices[node] = index
+		lowlinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range g.Depends[node] {
+			if g.Unresolved[next] {
+				continue
+			}
+			if _, visited := indices[next]; !visited {
+				connect(next)
+				if lowlinks[next] < lowlinks[node] {
+					lowlinks[node] = lowlinks[next]
+				}
+			} else if onStack[next] && indices[next] < lowlinks[node] {
+				lowlinks[node] = indices[next]
+			}
+		}
+
+		if lowlinks[node] == indices[node] {
+			members := []string{}
+			for {
+				last := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[last] = false
+				members = append(members, last)
+				if last == node {
+					break
+				}
+			}
+			components = append(components, members)
+		}
+	}
+
+	for _, node := range g.Nodes {
+		if _, visited := indices[node]; !visited {
+			connect(node)
+		}
+	}
+
+	return components
+}
+
+// unresolvedNodes lists the IDs of the unresolved dependencies in order
+func (g *Graph) unresolvedNodes() []string {
+	nodes := []string{}
+	for i := 0; i < len(g.Unresolved); i++ {
+		nodes = append(nodes, fmt.Sprintf("u%d", i))
+	}
+	return nodes
+}
+
+// Dot renders the graph in Graphviz DOT format. Children are solid edges,
+// dependencies dashed. Unresolved dependencies and cycles are red.
+func (g *Graph) Dot() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph hammer {\n")
+
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&buf, "  %q [label=%q];\n", node, g.Labels[node])
+	}
+	for _, node := range g.unresolvedNodes() {
+		fmt.Fprintf(&buf, "  %q [color=red, fontcolor=red, style=dashed, label=%q];\n", node, g.Labels[node]+" (unresolved)")
+	}
+
+	for _, node := range g.Nodes {
+		for _, child := range g.Children[node] {
+			fmt.Fprintf(&buf, "  %q -> %q;\n", node, child)
+		}
+		for _, depend := range g.Depends[node] {
+			attrs := "style=dashed"
+			if g.Unresolved[depend] || g.InCycle(node, depend) {
+				attrs += ", color=red"
+			}
+			fmt.Fprintf(&buf, "  %q -> %q [%s];\n", node, depend, attrs)
+		}
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Children are solid
+// edges, dependencies dotted. Unresolved dependencies and cycles are red.
+func (g *Graph) Mermaid() string {
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+
+	for _, node := range append(append([]string{}, g.Nodes...), g.unresolvedNodes()...) {
+		fmt.Fprintf(&buf, "  %s[\"%s\"]\n", node, mermaidLabel(g.Labels[node]))
+	}
+
+	edge := 0
+	red := []string{}
+	for _, node := range g.Nodes {
+		for _, child := range g.Children[node] {
+			fmt.Fprintf(&buf, "  %s --> %s\n", node, child)
+			edge++
+		}
+		for _, depend := range g.Depends[node] {
+			fmt.Fprintf(&buf, "  %s -. depends .-> %s\n", node, depend)
+			if g.Unresolved[depend] || g.InCycle(node, depend) {
+				red = append(red, fmt.Sprint(edge))
+			}
+			edge++
+		}
+	}
+
+	if len(g.Unresolved) > 0 {
+		buf.WriteString("  classDef unresolved stroke:#f00,color:#f00,stroke-dasharray:5 5\n")
+		for _, node := range g.unresolvedNodes() {
+			fmt.Fprintf(&buf, "  class %s unresolved\n", node)
+		}
+	}
+	if len(red) > 0 {
+		fmt.Fprintf(&buf, "  linkStyle %s stroke:#f00\n", strings.Join(red, ","))
+	}
+
+	return buf.String()
+}
+
+// mermaidLabel escapes a label for use inside quotes in Mermaid, which takes
+// HTML-like entity codes rather than backslash escapes. "#" is escaped too so
+// that it can't start an entity by accident.
+func mermaidLabel(label string) string {
+	return strings.NewReplacer("#", "#35;", `"`, "#quot;").Replace(label)
+}
+
+// Tree renders the graph as an indented tree of packages and their children,
+// listing the dependencies of each. Each node is only listed once.
+func (g *Graph) Tree() string {
+	var buf bytes.Buffer
+
+	visited := map[string]bool{}
+	var walk func(string, int)
+	walk = func(node string, depth int) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+
+		indent := strings.Repeat("  ", depth)
+		fmt.Fprintf(&buf, "%s%s\n", indent, g.Labels[node])
+
+		for _, depend := range g.Depends[node] {
+			note := ""
+			if g.Unresolved[depend] {
+				note = " (unresolved)"
+			} else if g.InCycle(node, depend) {
+				note = " (cycle)"
+			}
+			fmt.Fprintf(&buf, "%s  -> %s%s\n", indent, g.Labels[depend], note)
+		}
+
+		for _, child := range g.Children[node] {
+			walk(child, depth+1)
+		}
+	}
+
+	for _, root := range g.Roots {
+		walk(root, 0)
+	}
+
+	return buf.String()
+}
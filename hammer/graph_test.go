@@ -0,0 +1,104 @@
+package hammer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	specs := []string{`
+name: consul
+version: 0.5.2
+depends: [consul-ui]
+matrix:
+  os: [el6, el7]
+`, `
+name: consul-ui
+version: 0.5.2
+depends: ["consul >= 0.5", glibc]
+multi:
+- depends: [consul-ui]
+- name: consul-ui-extra
+`}
+
+	pkgs := []*Package{}
+	for _, spec := range specs {
+		p, err := NewPackageFromYAML([]byte(spec))
+		assert.Nil(t, err)
+		assert.Nil(t, p.ExpandRecursive(nil))
+		pkgs = append(pkgs, p)
+	}
+
+	g, err := NewGraph(pkgs)
+	assert.Nil(t, err)
+
+	// every package is a node, even when children share their parent's name
+	assert.Len(t, g.Nodes, 6)
+	assert.Equal(t, []string{"n0", "n3"}, g.Roots)
+	assert.Equal(t, []string{"n1", "n2"}, g.Children["n0"])
+	assert.Equal(t, "consul [os=el6]", g.Labels["n1"])
+	assert.Equal(t, "consul-ui", g.Labels["n4"])
+	assert.Equal(t, map[string]bool{"u0": true}, g.Unresolved)
+	assert.Equal(t, "glibc", g.Labels["u0"])
+
+	// dependencies point at the first package with the name, so only the
+	// parents are in the cycle
+	assert.Equal(t, `consul
+  -> consul-ui (cycle)
+  consul [os=el6]
+    -> consul-ui
+  consul [os=el7]
+    -> consul-ui
+consul-ui
+  -> consul (cycle)
+  -> glibc (unresolved)
+  consul-ui
+    -> consul-ui
+  consul-ui-extra
+    -> consul
+    -> glibc (unresolved)
+`, g.Tree())
+
+	assert.Equal(t, [][]string{{"consul", "consul-ui"}}, g.Cycles())
+
+	dot := g.Dot()
+	assert.True(t, strings.Contains(dot, `"n1" [label="consul [os=el6]"];`), dot)
+	assert.True(t, strings.Contains(dot, `"n0" -> "n1";`), dot)
+	assert.True(t, strings.Contains(dot, `"n3" -> "u0" [style=dashed, color=red];`), dot)
+
+	mermaid := g.Mermaid()
+	assert.True(t, strings.Contains(mermaid, `n4["consul-ui"]`), mermaid)
+	assert.True(t, strings.Contains(mermaid, "class u0 unresolved"), mermaid)
+}
+
+func TestGraphTreeVisitsNodesOnce(t *testing.T) {
+	g := &Graph{
+		Roots:    []string{"n0"},
+		Nodes:    []string{"n0", "n1"},
+		Labels:   map[string]string{"n0": "a", "n1": "a"},
+		Children: map[string][]string{"n0": {"n1"}, "n1": {"n0", "n1"}},
+	}
+
+	assert.Equal(t, "a\n  a\n", g.Tree())
+}
+
+func TestGraphMermaidEscapes(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`
+name: consul
+version: 0.5.2
+matrix:
+  greeting: ['say "hi"', "issue #12"]
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, p.ExpandRecursive(nil))
+
+	g, err := NewGraph([]*Package{p})
+	assert.Nil(t, err)
+
+	mermaid := g.Mermaid()
+	assert.True(t, strings.Contains(mermaid, `n1["consul [greeting=say #quot;hi#quot;]"]`), mermaid)
+	assert.True(t, strings.Contains(mermaid, `n2["consul [greeting=issue #35;12]"]`), mermaid)
+	assert.False(t, strings.Contains(mermaid, `\"`), mermaid)
+}
@@ -0,0 +1,830 @@
+package hammer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrNotImportable is returned when importing something that is neither an
+	// RPM spec nor a Debian control file (or a directory holding one.)
+	ErrNotImportable = errors.New("not an RPM .spec file or Debian control file")
+)
+
+// installRoot is where imported build scripts install to, and so where
+// imported targets are taken from
+const installRoot = "{{.BuildRoot}}/install"
+
+// Import is a Package converted from another packaging format. Warnings list
+// the parts of the original that could not be carried over.
+type Import struct {
+	Source   string
+	Package  *Package
+	Warnings []string
+}
+
+func newImport(source, pkgType string) *Import {
+	p := NewPackage()
+	p.Type = pkgType
+	p.Scripts = Scripts{}
+
+	return &Import{Source: source, Package: p}
+}
+
+func (i *Import) warn(format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	for _, existing := range i.Warnings {
+		if existing == warning {
+			return
+		}
+	}
+	i.Warnings = append(i.Warnings, warning)
+}
+
+// YAML renders the imported package as a spec, with the warnings in a comment
+// at the top.
+func (i *Import) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# imported from %s\n", i.Source)
+	if len(i.Warnings) > 0 {
+		buf.WriteString("#\n# these parts could not be imported, and need to be checked by hand:\n")
+		for _, warning := range i.Warnings {
+			fmt.Fprintf(&buf, "# - %s\n", warning)
+		}
+	}
+	buf.WriteString("---\n")
+
+	content, err := yaml.Marshal(i.Package)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(content)
+
+	return buf.Bytes(), nil
+}
+
+// ImportPath imports an RPM .spec file, a Debian control file, or a directory
+// holding a control file (directly or in "debian/")
+func ImportPath(name string) (*Import, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		switch {
+		case strings.HasSuffix(name, ".spec"):
+			content, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			return ImportRPM(name, content), nil
+
+		case filepath.Base(name) == "control":
+			return ImportDebian(filepath.Dir(name))
+		}
+
+		return nil, ErrNotImportable
+	}
+
+	for _, dir := range []string{name, filepath.Join(name, "debian")} {
+		if _, err := os.Stat(filepath.Join(dir, "control")); err == nil {
+			return ImportDebian(dir)
+		}
+	}
+
+	return nil, ErrNotImportable
+}
+
+// RPM
+
+// rpmMacros are common RPM macros and their equivalents in specs
+var rpmMacros = map[string]string{
+	"name":      "{{.Name}}",
+	"version":   "{{.Version}}",
+	"release":   "{{.Iteration}}",
+	"epoch":     "{{.Epoch}}",
+	"buildroot": installRoot,
+	"dist":      "",
+	"nil":       "",
+
+	"_prefix":         "/usr",
+	"_exec_prefix":    "/usr",
+	"_bindir":         "/usr/bin",
+	"_sbindir":        "/usr/sbin",
+	"_libdir":         "/usr/lib64",
+	"_libexecdir":     "/usr/libexec",
+	"_includedir":     "/usr/include",
+	"_datadir":        "/usr/share",
+	"_docdir":         "/usr/share/doc",
+	"_mandir":         "/usr/share/man",
+	"_infodir":        "/usr/share/info",
+	"_sysconfdir":     "/etc",
+	"_localstatedir":  "/var",
+	"_sharedstatedir": "/var/lib",
+	"_rundir":         "/run",
+	"_unitdir":        "/usr/lib/systemd/system",
+	"_tmpfilesdir":    "/usr/lib/tmpfiles.d",
+	"_initrddir":      "/etc/rc.d/init.d",
+
+	"_smp_mflags":  "-j{{.CPUs}}",
+	"make_build":   "make -j{{.CPUs}}",
+	"make_install": "make install DESTDIR=" + installRoot,
+	"configure":    "./configure --prefix=/usr --sysconfdir=/etc --localstatedir=/var",
+}
+
+// rpmScripts maps RPM scriptlet sections to script names
+var rpmScripts = map[string]string{
+	"pre":    "before-install",
+	"post":   "after-install",
+	"preun":  "before-remove",
+	"postun": "after-remove",
+}
+
+var (
+	rpmTagRe     = regexp.MustCompile(`^([A-Za-z]+[0-9]*)(\([^)]*\))?:\s*(.*)$`)
+	rpmSectionRe = regexp.MustCompile(`^%(description|package|prep|build|install|check|clean|pre|post|preun|postun|pretrans|posttrans|files|changelog|verifyscript|trigger[a-z]*|filetrigger[a-z]*)(\s+.*)?$`)
+	rpmMacroRe   = regexp.MustCompile(`%(\{([?!]*)([A-Za-z_][A-Za-z0-9_]*)(:[^}]*)?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+	rpmDependRe  = regexp.MustCompile(`([^\s,]+)(\s*(<=|>=|=|<|>)\s*([^\s,]+))?`)
+)
+
+// rpmImport holds the state of an RPM spec being imported
+type rpmImport struct {
+	*Import
+	macros  map[string]string
+	sources map[string]string // names of the sources, like "0" for Source0
+}
+
+// ImportRPM converts the content of an RPM .spec file, read from source.
+// Sources that are URLs become resources (without hashes), the %prep, %build
+// and %install sections become the build script, installing to
+// {{.BuildRoot}}/install, and %files become targets taken from there.
+func ImportRPM(source string, content []byte) *Import {
+	r := &rpmImport{
+		Import:  newImport(source, "rpm"),
+		macros:  map[string]string{},
+		sources: map[string]string{},
+	}
+	p := r.Package
+
+	section := ""
+	description := []string{}
+	build := []string{}
+	scripts := map[string][]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if match := rpmSectionRe.FindStringSubmatch(trimmed); match != nil {
+			section = match[1]
+			args := parseRPMSectionArgs(match[2])
+
+			if section == "package" || args.subpackage != "" {
+				r.warn("subpackage sections (%s) are not imported, add them as subpackages", trimmed)
+				section = "skip"
+				continue
+			}
+			if args.fileList != "" {
+				r.warn("file lists (%s) are not imported", trimmed)
+			}
+
+			switch section {
+			case "prep", "build", "install":
+				build = append(build, "# %"+section)
+			case "pre", "post", "preun", "postun":
+				if args.interpreter == "<lua>" {
+					r.warn("lua scriptlets (%s) are not imported", trimmed)
+					section = "skip"
+				} else if args.interpreter != "" {
+					scripts[section] = append(scripts[section], args.interpreter)
+					section = "skip"
+				}
+			case "check":
+				r.warn("%%check is not run, add it to the end of the build script if needed")
+			case "files":
+			case "changelog":
+				r.warn("the changelog is not imported")
+			case "description", "clean":
+			default:
+				r.warn("%%%s is not imported", section)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "%if") || strings.HasPrefix(trimmed, "%else") || strings.HasPrefix(trimmed, "%endif") {
+			r.warn("conditionals (%%if) are not evaluated, the contents of every branch were kept")
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "%define") || strings.HasPrefix(trimmed, "%global") {
+			fields := strings.Fields(trimmed)
+			if len(fields) >= 2 {
+				r.macros[fields[1]] = strings.Join(fields[2:], " ")
+			}
+			continue
+		}
+
+		switch section {
+		case "":
+			r.preamble(trimmed)
+
+		case "description":
+			description = append(description, line)
+
+		case "prep", "build", "install":
+			build = append(build, r.buildLine(line))
+
+		case "pre", "post", "preun", "postun":
+			scripts[section] = append(scripts[section], r.expand(line))
+
+		case "files":
+			r.filesLine(trimmed)
+		}
+	}
+
+	if p.Description == "" {
+		p.Description = strings.TrimSpace(strings.Join(description, "\n"))
+	}
+
+	if len(build) > 0 {
+		p.Scripts["build"] = strings.TrimSpace(strings.Join(build, "\n")) + "\n"
+	}
+	for section, lines := range scripts {
+		script := strings.TrimSpace(strings.Join(lines, "\n"))
+		if script != "" {
+			p.Scripts[rpmScripts[section]] = script + "\n"
+		}
+	}
+
+	return r.Import
+}
+
+// preamble reads a "Tag: value" line from the top of the spec
+func (r *rpmImport) preamble(line string) {
+	match := rpmTagRe.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	p := r.Package
+	tag := strings.ToLower(match[1])
+	value := r.expand(match[3])
+
+	switch {
+	case tag == "name":
+		p.Name = value
+	case tag == "version":
+		p.Version = value
+	case tag == "release":
+		p.Iteration = value
+	case tag == "epoch":
+		p.Epoch = value
+	case tag == "summary":
+		p.Description = value
+	case tag == "license":
+		p.License = value
+	case tag == "url":
+		p.URL = value
+	case tag == "vendor":
+		p.Vendor = value
+	case tag == "buildarch" || tag == "exclusivearch":
+		p.Architecture = value
+	case tag == "requires":
+		p.Depends = append(p.Depends, splitRPMDepends(value)...)
+	case tag == "obsoletes":
+		p.Obsoletes = append(p.Obsoletes, splitRPMDepends(value)...)
+	case strings.HasPrefix(tag, "source"):
+		r.source(strings.TrimPrefix(tag, "source"), value)
+	case strings.HasPrefix(tag, "patch"):
+		r.warn("patches are not applied, apply %s in the build script", value)
+	case tag == "buildrequires":
+		r.warn("build requirements are not imported, install %s on the build machine", value)
+	case tag == "group" || tag == "buildroot":
+	default:
+		r.warn("%s is not imported", match[1])
+	}
+}
+
+// rpmSectionArgs are the options given to a section, like "%files -n foo"
+type rpmSectionArgs struct {
+	subpackage  string // from "-n name", or just "name"
+	interpreter string // from "-p", for scriptlets
+	fileList    string // from "-f", for %files
+}
+
+func parseRPMSectionArgs(raw string) rpmSectionArgs {
+	args := rpmSectionArgs{}
+	fields := strings.Fields(raw)
+
+	for i := 0; i < len(fields); i++ {
+		value := ""
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+
+		switch fields[i] {
+		case "-n":
+			args.subpackage = value
+			i++
+		case "-f":
+			args.fileList = value
+			i++
+		case "-p":
+			args.interpreter = strings.Join(fields[i+1:], " ")
+			return args
+		default:
+			if !strings.HasPrefix(fields[i], "-") {
+				args.subpackage = fields[i]
+			}
+		}
+	}
+
+	return args
+}
+
+// source adds a Source tag. URLs become resources, anything else is a file
+// expected next to the spec.
+func (r *rpmImport) source(n, value string) {
+	if n == "" {
+		n = "0"
+	}
+
+	if strings.Contains(value, "://") {
+		r.Package.Resources = append(r.Package.Resources, Resource{URL: value, HashType: "sha256"})
+		r.sources[n] = path.Base(value)
+		r.warn("fill in the hash of %s", value)
+	} else {
+		r.sources[n] = "{{.SpecRoot}}/" + value
+		r.warn("copy %s next to the spec", value)
+	}
+}
+
+// expand replaces RPM macros with their values or the equivalent templates.
+// Unknown macros are left as they are.
+func (r *rpmImport) expand(line string) string {
+	// "%%" is a literal percent sign, as are unknown macros once seen
+	const percent = "\x00"
+	line = strings.Replace(line, "%%", percent, -1)
+
+	for depth := 0; depth < 10 && strings.Contains(line, "%"); depth++ {
+		expanded := rpmMacroRe.ReplaceAllStringFunc(line, func(macro string) string {
+			match := rpmMacroRe.FindStringSubmatch(macro)
+			flags, name, bare := match[2], match[3], match[5] != ""
+			if bare {
+				name = match[5]
+			}
+
+			if value, ok := rpmMacros[name]; ok {
+				return value
+			}
+			if value, ok := r.macros[name]; ok {
+				return value
+			}
+			if strings.HasPrefix(name, "SOURCE") {
+				if value, ok := r.sources[strings.TrimPrefix(name, "SOURCE")]; ok {
+					return value
+				}
+			}
+
+			if strings.Contains(flags, "?") {
+				return ""
+			}
+			// short bare macros are more likely to be printf verbs
+			if !bare || len(name) > 1 {
+				r.warn("macro %%%s is not known, and was left as is", name)
+			}
+			return percent + macro[1:]
+		})
+		if expanded == line {
+			break
+		}
+		line = expanded
+	}
+
+	line = strings.Replace(line, "$RPM_BUILD_ROOT", installRoot, -1)
+	line = strings.Replace(line, "${RPM_BUILD_ROOT}", installRoot, -1)
+	return strings.Replace(line, percent, "%", -1)
+}
+
+// buildLine converts a line of %prep, %build or %install
+func (r *rpmImport) buildLine(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return line
+	}
+
+	switch fields[0] {
+	case "%setup":
+		return r.setup(fields[1:])
+	case "%autosetup":
+		r.warn("patches are not applied by %%autosetup, apply them in the build script")
+		return r.setup(fields[1:])
+	}
+
+	if strings.HasPrefix(fields[0], "%patch") {
+		r.warn("patches are not applied, apply them in the build script")
+		return "# " + line
+	}
+
+	return r.expand(line)
+}
+
+// setup converts %setup into commands unpacking Source0
+func (r *rpmImport) setup(args []string) string {
+	dir := "{{.Name}}-{{.Version}}"
+	create, unpack := false, true
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-n":
+			if i+1 < len(args) {
+				dir = r.expand(args[i+1])
+				i++
+			}
+		case "-c":
+			create = true
+		case "-T":
+			unpack = false
+		case "-a", "-b":
+			r.warn("%%setup %s is not imported, unpack the extra source in the build script", args[i])
+			i++
+		}
+	}
+
+	source := r.sources["0"]
+	if strings.HasPrefix(source, "{{.SpecRoot}}") {
+		// local sources are read from where they are
+	} else if source != "" {
+		source = "{{.BuildRoot}}/" + source
+	}
+
+	command := "tar -xf " + source
+	if strings.HasSuffix(source, ".zip") {
+		command = "unzip -q " + source
+	}
+
+	lines := []string{}
+	if create {
+		lines = append(lines, "mkdir -p "+dir, "cd "+dir)
+		if unpack && source != "" {
+			lines = append(lines, command)
+		}
+	} else {
+		if unpack && source != "" {
+			lines = append(lines, command)
+		}
+		lines = append(lines, "cd "+dir)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// filesLine converts a line of %files into a target
+func (r *rpmImport) filesLine(line string) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	target := Target{}
+directives:
+	for strings.HasPrefix(line, "%") {
+		directive, args, rest := splitFilesDirective(line)
+
+		switch directive {
+		case "%defattr":
+			return
+		case "%attr":
+			parts := strings.Split(args, ",")
+			for i, dest := range []*string{&target.Mode, &target.User, &target.Group} {
+				if i < len(parts) && strings.TrimSpace(parts[i]) != "-" {
+					*dest = strings.TrimSpace(parts[i])
+				}
+			}
+		case "%config":
+			target.Config = true
+		case "%dir":
+			target.Type = TargetDir
+		case "%doc", "%license", "%ghost", "%exclude":
+			r.warn("%s %s is not imported", directive, rest)
+			return
+		case "%verify", "%lang", "%caps":
+			r.warn("%s is not imported, for %s", directive, rest)
+		default:
+			// a macro standing for a path, like %{_bindir}/foo
+			break directives
+		}
+
+		line = rest
+	}
+
+	for _, name := range strings.Fields(line) {
+		name = r.expand(name)
+		t := target
+		t.Dest = name
+		if t.Type != TargetDir {
+			t.Src = installRoot + name
+			if strings.ContainsAny(name, "*?[") {
+				t.Dest = path.Dir(name) + "/"
+			}
+		}
+		r.Package.Targets = append(r.Package.Targets, t)
+	}
+}
+
+// splitFilesDirective splits a line like "%attr(0755,root,root) /usr/bin/foo"
+// into the directive, its arguments and the rest of the line
+func splitFilesDirective(line string) (directive, args, rest string) {
+	end := strings.IndexAny(line, " \t(")
+	if end < 0 {
+		return line, "", ""
+	}
+	directive, rest = line[:end], line[end:]
+
+	if rest[0] == '(' {
+		if close := strings.Index(rest, ")"); close > 0 {
+			args, rest = rest[1:close], rest[close+1:]
+		}
+	}
+
+	return directive, args, strings.TrimSpace(rest)
+}
+
+// splitRPMDepends splits a list of dependencies like "a, b >= 1.0 c" into
+// "a", "b >= 1.0" and "c"
+func splitRPMDepends(value string) []string {
+	depends := []string{}
+	for _, match := range rpmDependRe.FindAllStringSubmatch(value, -1) {
+		depend := match[1]
+		if match[2] != "" {
+			depend += " " + match[3] + " " + match[4]
+		}
+		depends = append(depends, depend)
+	}
+	return depends
+}
+
+// Debian
+
+// debianScripts maps maintainer scripts to script names
+var debianScripts = map[string]string{
+	"preinst":  "before-install",
+	"postinst": "after-install",
+	"prerm":    "before-remove",
+	"postrm":   "after-remove",
+}
+
+// debianIgnored are control fields that have no meaning for Hammer
+var debianIgnored = map[string]bool{
+	"source":            true,
+	"section":           true,
+	"priority":          true,
+	"standards-version": true,
+	"vcs-git":           true,
+	"vcs-browser":       true,
+	"multi-arch":        true,
+}
+
+var changelogRe = regexp.MustCompile(`^\S+ \(([^)]+)\)`)
+
+// ImportDebian converts a Debian package from a directory with a control file
+// (like "debian/" or "DEBIAN/".) The first binary package in control is
+// imported, along with its maintainer scripts, conffiles, dirs and install
+// files. The version comes from control, or else from the changelog.
+func ImportDebian(dir string) (*Import, error) {
+	i := newImport(filepath.Join(dir, "control"), "deb")
+	p := i.Package
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "control"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkg map[string]string
+	for _, stanza := range parseControl(content) {
+		if _, ok := stanza["package"]; !ok {
+			for _, field := range sortedFields(stanza) {
+				value := stanza[field]
+				switch field {
+				case "build-depends":
+					i.warn("build dependencies are not imported, install %s on the build machine", value)
+				case "homepage":
+					p.URL = value
+				default:
+					if !debianIgnored[field] {
+						i.warn("%s is not imported", field)
+					}
+				}
+			}
+			continue
+		}
+
+		if pkg != nil {
+			i.warn("package %s is not imported, add it as a subpackage or a separate spec", stanza["package"])
+			continue
+		}
+		pkg = stanza
+	}
+	if pkg == nil {
+		return nil, ErrNotImportable
+	}
+
+	for _, field := range sortedFields(pkg) {
+		value := pkg[field]
+		switch field {
+		case "package":
+			p.Name = value
+		case "version":
+			i.version(value)
+		case "architecture":
+			if value != "any" {
+				p.Architecture = value
+			}
+		case "depends", "pre-depends":
+			for _, depend := range strings.Split(value, ",") {
+				depend = strings.TrimSpace(depend)
+				if strings.HasPrefix(depend, "${") {
+					i.warn("substitution variables like %s are not imported", depend)
+					continue
+				}
+				if strings.Contains(depend, "|") {
+					i.warn("alternative dependencies (%s) were kept as written, check your package type supports them", depend)
+				}
+				p.Depends = append(p.Depends, depend)
+			}
+		case "description":
+			p.Description = strings.SplitN(value, "\n", 2)[0]
+		case "homepage":
+			p.URL = value
+		default:
+			if !debianIgnored[field] {
+				i.warn("%s is not imported", field)
+			}
+		}
+	}
+
+	if p.Version == "" {
+		changelog, err := ioutil.ReadFile(filepath.Join(dir, "changelog"))
+		if match := changelogRe.FindSubmatch(changelog); err == nil && match != nil {
+			i.version(string(match[1]))
+		} else {
+			i.warn("no version found in control or changelog")
+		}
+	}
+
+	// debhelper names files after the package when there's more than one
+	read := func(name string) ([]byte, bool) {
+		for _, candidate := range []string{p.Name + "." + name, name} {
+			content, err := ioutil.ReadFile(filepath.Join(dir, candidate))
+			if err == nil {
+				return content, true
+			}
+		}
+		return nil, false
+	}
+
+	for file, script := range debianScripts {
+		content, ok := read(file)
+		if !ok {
+			continue
+		}
+
+		lines := []string{}
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.TrimSpace(line) == "#DEBHELPER#" {
+				i.warn("debhelper snippets (#DEBHELPER#) are not generated")
+				continue
+			}
+			lines = append(lines, line)
+		}
+		p.Scripts[script] = strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+	}
+
+	if content, ok := read("install"); ok {
+		for _, fields := range debianLines(content) {
+			if len(fields) == 1 {
+				p.Targets = append(p.Targets, Target{
+					Src:  installRoot + "/" + strings.TrimPrefix(fields[0], "/"),
+					Dest: "/" + path.Dir(strings.TrimPrefix(fields[0], "/")) + "/",
+				})
+				continue
+			}
+
+			dest := "/" + strings.Trim(fields[len(fields)-1], "/") + "/"
+			for _, src := range fields[:len(fields)-1] {
+				p.Targets = append(p.Targets, Target{Src: "{{.BuildRoot}}/" + src, Dest: dest})
+			}
+		}
+	}
+
+	if content, ok := read("dirs"); ok {
+		for _, fields := range debianLines(content) {
+			p.Targets = append(p.Targets, Target{Dest: "/" + strings.TrimPrefix(fields[0], "/"), Type: TargetDir})
+		}
+	}
+
+	if content, ok := read("conffiles"); ok {
+	conffiles:
+		for _, fields := range debianLines(content) {
+			conffile := fields[0]
+			for n, target := range p.Targets {
+				if target.Dest == conffile || strings.HasSuffix(target.Dest, "/") && target.Dest+path.Base(target.Src) == conffile {
+					p.Targets[n].Config = true
+					continue conffiles
+				}
+			}
+			p.Targets = append(p.Targets, Target{Src: installRoot + conffile, Dest: conffile, Config: true})
+			i.warn("conffile %s is not in debian/install, make the build script install it to %s%s", conffile, installRoot, conffile)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "rules")); err == nil {
+		i.warn("debian/rules is not imported, write a build script that installs to %s", installRoot)
+	}
+
+	return i, nil
+}
+
+// version sets the epoch, version and iteration from a Debian version like
+// "1:0.6.4-2"
+func (i *Import) version(value string) {
+	p := i.Package
+	if colon := strings.Index(value, ":"); colon >= 0 {
+		p.Epoch, value = value[:colon], value[colon+1:]
+	}
+	if dash := strings.LastIndex(value, "-"); dash >= 0 {
+		p.Iteration, value = value[dash+1:], value[:dash]
+	}
+	p.Version = value
+}
+
+// parseControl reads the stanzas of a Debian control file. Field names are
+// lowercased, and continuation lines are joined with newlines.
+func parseControl(content []byte) []map[string]string {
+	stanzas := []map[string]string{}
+	stanza := map[string]string{}
+	last := ""
+
+	for _, line := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = map[string]string{}
+			}
+		case strings.HasPrefix(line, "#"):
+		case line[0] == ' ' || line[0] == '\t':
+			if last != "" {
+				continuation := strings.TrimSpace(line)
+				if continuation == "." {
+					continuation = ""
+				}
+				stanza[last] += "\n" + continuation
+			}
+		default:
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			last = strings.ToLower(strings.TrimSpace(parts[0]))
+			stanza[last] = strings.TrimSpace(parts[1])
+		}
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+
+	return stanzas
+}
+
+// sortedFields returns the field names of a control stanza in order
+func sortedFields(stanza map[string]string) []string {
+	fields := []string{}
+	for field := range stanza {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// debianLines splits a debhelper file into the fields of each non-empty line
+func debianLines(content []byte) [][]string {
+	lines := [][]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportRPM(t *testing.T) {
+	imported, err := ImportPath("testdata/consul.spec")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := imported.Package
+
+	assert.Equal(t, "consul", p.Name)
+	assert.Equal(t, "0.6.4", p.Version)
+	assert.Equal(t, "2", p.Iteration)
+	assert.Equal(t, "1", p.Epoch)
+	assert.Equal(t, "rpm", p.Type)
+	assert.Equal(t, "x86_64", p.Architecture)
+	assert.Equal(t, "Consul is a tool for service discovery and configuration", p.Description)
+	assert.Equal(t, []string{"systemd", "glibc >= 2.12", "shadow-utils"}, p.Depends)
+	assert.Equal(t, []string{"consul-server < 0.6"}, p.Obsoletes)
+
+	assert.Equal(t, []Resource{{
+		URL:      "https://releases.hashicorp.com/{{.Name}}/{{.Version}}/{{.Name}}_{{.Version}}_linux_amd64.zip",
+		HashType: "sha256",
+	}}, p.Resources)
+
+	assert.Equal(t, `# %prep
+mkdir -p {{.Name}}-{{.Version}}
+cd {{.Name}}-{{.Version}}
+unzip -q {{.BuildRoot}}/{{.Name}}_{{.Version}}_linux_amd64.zip
+
+# %build
+
+# %install
+mkdir -p {{.BuildRoot}}/install/usr/bin {{.BuildRoot}}/install/etc/{{.Name}}
+install -m 0755 {{.Name}} {{.BuildRoot}}/install/usr/bin/{{.Name}}
+install -m 0644 {{.SpecRoot}}/{{.Name}}.json {{.BuildRoot}}/install/etc/{{.Name}}/
+`, p.Scripts["build"])
+	assert.Equal(t, "getent group consul >/dev/null || groupadd -r consul\n", p.Scripts["before-install"])
+	assert.Equal(t, "%systemd_post consul.service\n", p.Scripts["after-install"])
+	assert.Equal(t, "rm -rf /var/lib/{{.Name}}\n", p.Scripts["after-remove"])
+
+	assert.Equal(t, []Target{
+		{Src: "{{.BuildRoot}}/install/usr/bin/{{.Name}}", Dest: "/usr/bin/{{.Name}}", Mode: "0755", User: "root", Group: "root"},
+		{Src: "{{.BuildRoot}}/install/etc/{{.Name}}/{{.Name}}.json", Dest: "/etc/{{.Name}}/{{.Name}}.json", Config: true},
+		{Dest: "/var/lib/{{.Name}}", Type: TargetDir, Mode: "0750", User: "consul", Group: "consul"},
+	}, p.Targets)
+
+	assert.Equal(t, []string{
+		"fill in the hash of https://releases.hashicorp.com/{{.Name}}/{{.Version}}/{{.Name}}_{{.Version}}_linux_amd64.zip",
+		"copy {{.Name}}.json next to the spec",
+		"patches are not applied, apply fix-paths.patch in the build script",
+		"build requirements are not imported, install unzip on the build machine",
+		"macro %systemd_post is not known, and was left as is",
+		"%doc README.md is not imported",
+		"the changelog is not imported",
+	}, imported.Warnings)
+
+	content, err := imported.YAML()
+	assert.NoError(t, err)
+	roundtrip, err := NewPackageFromYAML(content)
+	assert.NoError(t, err)
+	assert.Equal(t, p.Targets, roundtrip.Targets)
+}
+
+func TestImportDebian(t *testing.T) {
+	imported, err := ImportPath("testdata")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := imported.Package
+
+	assert.Equal(t, "consul", p.Name)
+	assert.Equal(t, "0.6.4", p.Version)
+	assert.Equal(t, "2", p.Iteration)
+	assert.Equal(t, "1", p.Epoch)
+	assert.Equal(t, "deb", p.Type)
+	assert.Equal(t, "amd64", p.Architecture)
+	assert.Equal(t, "https://www.consul.io", p.URL)
+	assert.Equal(t, "tool for service discovery and configuration", p.Description)
+	assert.Equal(t, []string{"adduser", "libc6 (>= 2.15) | libc6-compat"}, p.Depends)
+
+	assert.Equal(t, Scripts{
+		"after-install": "#!/bin/sh\nset -e\n\nadduser --system --group consul\n",
+		"after-remove":  "#!/bin/sh\nset -e\n\nif [ \"$1\" = \"purge\" ]; then\n  rm -rf /var/lib/consul\nfi\n",
+	}, p.Scripts)
+
+	assert.Equal(t, []Target{
+		{Src: "{{.BuildRoot}}/consul", Dest: "/usr/bin/"},
+		{Src: "{{.BuildRoot}}/install/etc/consul/consul.json", Dest: "/etc/consul/consul.json", Config: true},
+	}, p.Targets)
+
+	assert.Contains(t, imported.Warnings, "package consul-web-ui is not imported, add it as a subpackage or a separate spec")
+	assert.Contains(t, imported.Warnings, "debhelper snippets (#DEBHELPER#) are not generated")
+	assert.Contains(t, imported.Warnings, "substitution variables like ${misc:Depends} are not imported")
+	assert.Contains(t, imported.Warnings, "maintainer is not imported")
+	assert.Contains(t, imported.Warnings, "conffile /etc/consul/consul.json is not in debian/install, make the build script install it to {{.BuildRoot}}/install/etc/consul/consul.json")
+
+	_, err = ImportPath("testdata/debian/changelog")
+	assert.Equal(t, ErrNotImportable, err)
+}
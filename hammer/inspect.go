@@ -0,0 +1,439 @@
+package hammer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	// ErrUnknownArchive is returned when asked to inspect a file that Hammer
+	// does not know how to open.
+	ErrUnknownArchive = errors.New("unknown archive format")
+
+	// ErrBadArchive is returned when an archive is truncated or otherwise
+	// malformed.
+	ErrBadArchive = errors.New("malformed archive")
+)
+
+// ArchiveEntry describes a single file inside a built package
+type ArchiveEntry struct {
+	Path   string
+	Mode   os.FileMode
+	User   string
+	Group  string
+	Config bool
+	Link   string
+}
+
+// InspectArchive opens a built package (rpm, deb or tar) and lists the files
+// inside it. Paths are returned as absolute paths on the installed system.
+func InspectArchive(name string) ([]ArchiveEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch {
+	case strings.HasSuffix(name, ".rpm"):
+		return inspectRPM(bufio.NewReader(f))
+	case strings.HasSuffix(name, ".deb"):
+		return inspectDeb(f)
+	case strings.HasSuffix(name, ".tar"):
+		return inspectTar(f, nil)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return inspectTar(gz, nil)
+	default:
+		return nil, ErrUnknownArchive
+	}
+}
+
+// unixMode converts the st_mode bits stored in package headers to an
+// os.FileMode
+func unixMode(mode uint32) os.FileMode {
+	out := os.FileMode(mode & 0777)
+	switch mode & 0170000 {
+	case 0040000:
+		out |= os.ModeDir
+	case 0120000:
+		out |= os.ModeSymlink
+	}
+	if mode&04000 != 0 {
+		out |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		out |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		out |= os.ModeSticky
+	}
+	return out
+}
+
+// cleanArchivePath turns the various relative forms used inside archives
+// ("./usr/bin/foo", "usr/bin/foo") into "/usr/bin/foo"
+func cleanArchivePath(name string) string {
+	return path.Clean("/" + strings.TrimPrefix(name, "."))
+}
+
+// tar
+
+func inspectTar(r io.Reader, configs map[string]bool) ([]ArchiveEntry, error) {
+	entries := []ArchiveEntry{}
+	reader := tar.NewReader(r)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return entries, err
+		}
+
+		name := cleanArchivePath(header.Name)
+		if name == "/" {
+			continue
+		}
+
+		entries = append(entries, ArchiveEntry{
+			Path:   name,
+			Mode:   header.FileInfo().Mode(),
+			User:   header.Uname,
+			Group:  header.Gname,
+			Config: configs[name],
+			Link:   header.Linkname,
+		})
+	}
+
+	return entries, nil
+}
+
+// deb
+
+func inspectDeb(r io.Reader) ([]ArchiveEntry, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != "!<arch>\n" {
+		return nil, ErrBadArchive
+	}
+
+	var (
+		configs = map[string]bool{}
+		data    []byte
+		dataExt string
+	)
+
+	for {
+		header := make([]byte, 60)
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimRight(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, ErrBadArchive
+		}
+
+		content := make([]byte, size)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, err
+		}
+		if size%2 == 1 { // members are aligned to two bytes
+			if _, err := io.ReadFull(r, make([]byte, 1)); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(name, "control.tar"):
+			err = debConffiles(name, content, configs)
+			if err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(name, "data.tar"):
+			data = content
+			dataExt = strings.TrimPrefix(name, "data.tar")
+		}
+	}
+
+	if data == nil {
+		return nil, ErrBadArchive
+	}
+
+	reader, err := decompressor(dataExt, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return inspectTar(reader, configs)
+}
+
+func debConffiles(name string, content []byte, configs map[string]bool) error {
+	reader, err := decompressor(strings.TrimPrefix(name, "control.tar"), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	control := tar.NewReader(reader)
+	for {
+		header, err := control.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if cleanArchivePath(header.Name) != "/conffiles" {
+			continue
+		}
+
+		raw, err := ioutil.ReadAll(control)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				configs[line] = true
+			}
+		}
+	}
+}
+
+// decompressor opens a deb member by its compression extension, as in
+// "data.tar.xz". These are the compressions dpkg-deb can write.
+func decompressor(ext string, r io.Reader) (io.ReadCloser, error) {
+	switch ext {
+	case "":
+		return ioutil.NopCloser(r), nil
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".bz2":
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case ".xz":
+		reader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(reader), nil
+	case ".zst":
+		reader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return reader.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q, expected none, .gz, .bz2, .xz or .zst", ext)
+	}
+}
+
+// rpm
+
+const (
+	rpmTagOldFilenames  = 1027
+	rpmTagFileModes     = 1030
+	rpmTagFileLinkTos   = 1036
+	rpmTagFileFlags     = 1037
+	rpmTagFileUsername  = 1039
+	rpmTagFileGroupname = 1040
+	rpmTagDirIndexes    = 1116
+	rpmTagBasenames     = 1117
+	rpmTagDirnames      = 1118
+
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+
+	rpmFileConfig = 1 << 0
+)
+
+type rpmHeader struct {
+	strings map[int][]string
+	ints    map[int][]uint32
+}
+
+func inspectRPM(r io.Reader) ([]ArchiveEntry, error) {
+	lead := make([]byte, 96)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(lead[0:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return nil, ErrBadArchive
+	}
+
+	// the signature header is padded out to an eight byte boundary
+	sigSize, err := skipRPMHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if pad := (8 - sigSize%8) % 8; pad != 0 {
+		if _, err := io.ReadFull(r, make([]byte, pad)); err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := readRPMHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if basenames := header.strings[rpmTagBasenames]; len(basenames) > 0 {
+		dirnames := header.strings[rpmTagDirnames]
+		indexes := header.ints[rpmTagDirIndexes]
+		if len(indexes) != len(basenames) {
+			return nil, ErrBadArchive
+		}
+		for i, base := range basenames {
+			if int(indexes[i]) >= len(dirnames) {
+				return nil, ErrBadArchive
+			}
+			names = append(names, dirnames[indexes[i]]+base)
+		}
+	} else {
+		names = header.strings[rpmTagOldFilenames]
+	}
+
+	index := func(values []uint32, i int) uint32 {
+		if i < len(values) {
+			return values[i]
+		}
+		return 0
+	}
+	stringIndex := func(values []string, i int) string {
+		if i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+
+	entries := []ArchiveEntry{}
+	for i, name := range names {
+		entries = append(entries, ArchiveEntry{
+			Path:   cleanArchivePath(name),
+			Mode:   unixMode(index(header.ints[rpmTagFileModes], i)),
+			User:   stringIndex(header.strings[rpmTagFileUsername], i),
+			Group:  stringIndex(header.strings[rpmTagFileGroupname], i),
+			Config: index(header.ints[rpmTagFileFlags], i)&rpmFileConfig != 0,
+			Link:   stringIndex(header.strings[rpmTagFileLinkTos], i),
+		})
+	}
+
+	return entries, nil
+}
+
+// readRPMHeaderIntro reads the fixed part of a header structure and returns the
+// number of index entries and the size of the data store.
+func readRPMHeaderIntro(r io.Reader) (uint32, uint32, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(intro[0:3], []byte{0x8e, 0xad, 0xe8}) {
+		return 0, 0, ErrBadArchive
+	}
+
+	return binary.BigEndian.Uint32(intro[8:12]), binary.BigEndian.Uint32(intro[12:16]), nil
+}
+
+func skipRPMHeader(r io.Reader) (int, error) {
+	count, size, err := readRPMHeaderIntro(r)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.CopyN(ioutil.Discard, r, int64(count*16+size))
+	return int(n), err
+}
+
+func readRPMHeader(r io.Reader) (*rpmHeader, error) {
+	count, size, err := readRPMHeaderIntro(r)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make([]byte, count*16)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, err
+	}
+	store := make([]byte, size)
+	if _, err := io.ReadFull(r, store); err != nil {
+		return nil, err
+	}
+
+	header := &rpmHeader{
+		strings: map[int][]string{},
+		ints:    map[int][]uint32{},
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := index[i*16 : i*16+16]
+		tag := int(binary.BigEndian.Uint32(entry[0:4]))
+		kind := binary.BigEndian.Uint32(entry[4:8])
+		offset := binary.BigEndian.Uint32(entry[8:12])
+		n := binary.BigEndian.Uint32(entry[12:16])
+
+		if offset > size {
+			return nil, ErrBadArchive
+		}
+		data := store[offset:]
+
+		switch kind {
+		case rpmTypeInt16:
+			if uint32(len(data)) < n*2 {
+				return nil, ErrBadArchive
+			}
+			for j := uint32(0); j < n; j++ {
+				header.ints[tag] = append(header.ints[tag], uint32(binary.BigEndian.Uint16(data[j*2:])))
+			}
+
+		case rpmTypeInt32:
+			if uint32(len(data)) < n*4 {
+				return nil, ErrBadArchive
+			}
+			for j := uint32(0); j < n; j++ {
+				header.ints[tag] = append(header.ints[tag], binary.BigEndian.Uint32(data[j*4:]))
+			}
+
+		case rpmTypeString, rpmTypeStringArray:
+			for j := uint32(0); j < n; j++ {
+				end := bytes.IndexByte(data, 0)
+				if end < 0 {
+					return nil, ErrBadArchive
+				}
+				header.strings[tag] = append(header.strings[tag], string(data[:end]))
+				data = data[end+1:]
+			}
+		}
+	}
+
+	return header, nil
+}
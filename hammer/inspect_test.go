@@ -0,0 +1,92 @@
+package hammer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectArchive(t *testing.T) {
+	// testdata/archives holds the same three files packaged in each format:
+	// an executable, a symlink to it and a config file
+	tests := []struct {
+		name        string
+		user, group string
+		config      bool
+	}{
+		{"example-gzip.deb", "root", "root", true},
+		{"example-xz.deb", "root", "root", true},
+		{"example-zstd.deb", "root", "root", true},
+		{"example.rpm", "example", "example", true},
+		{"example.tar.gz", "root", "root", false},
+	}
+
+	for _, test := range tests {
+		entries, err := InspectArchive(path.Join("testdata", "archives", test.name))
+		if !assert.NoError(t, err, test.name) {
+			continue
+		}
+
+		byPath := map[string]ArchiveEntry{}
+		for _, entry := range entries {
+			byPath[entry.Path] = entry
+		}
+
+		assert.Equal(t, os.FileMode(0755), byPath["/usr/bin/example"].Mode, test.name)
+		assert.Equal(t, "example", byPath["/usr/bin/ex"].Link, test.name)
+		assert.True(t, byPath["/usr/bin/ex"].Mode&os.ModeSymlink != 0, test.name)
+
+		conf := byPath["/etc/example/example.conf"]
+		assert.Equal(t, os.FileMode(0640), conf.Mode, test.name)
+		assert.Equal(t, test.user, conf.User, test.name)
+		assert.Equal(t, test.group, conf.Group, test.name)
+		assert.Equal(t, test.config, conf.Config, test.name)
+		assert.False(t, byPath["/usr/bin/example"].Config, test.name)
+	}
+}
+
+func TestInspectArchiveErrors(t *testing.T) {
+	_, err := InspectArchive("testdata/consul.spec")
+	assert.Equal(t, ErrUnknownArchive, err)
+
+	_, err = inspectDeb(bytes.NewReader([]byte("not an ar archive")))
+	assert.Equal(t, ErrBadArchive, err)
+
+	_, err = inspectRPM(bytes.NewReader(make([]byte, 96)))
+	assert.Equal(t, ErrBadArchive, err)
+
+	_, err = decompressor(".lzma", bytes.NewReader(nil))
+	assert.EqualError(t, err, `unsupported compression ".lzma", expected none, .gz, .bz2, .xz or .zst`)
+}
+
+func TestVerifyEntriesAttrMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-verify-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := path.Join(dir, "example")
+	assert.Nil(t, ioutil.WriteFile(src, []byte("#!/bin/sh\n"), 0644))
+
+	p := NewPackage()
+	p.Attrs = []Attr{{File: "/usr/bin/example", Mode: "0755"}}
+	p.fpm = &FPM{
+		Package:  p,
+		mappings: []targetMapping{{src, "/usr/bin/", Target{Src: src, Dest: "/usr/bin/"}}},
+	}
+
+	entries := []ArchiveEntry{{Path: "/usr/bin/example", Mode: 0755}}
+
+	// the attr sets the mode in an rpm
+	problems, err := p.verifyEntries("example.rpm", entries)
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+
+	// other formats ignore attrs, so the mode of the source is expected
+	problems, err = p.verifyEntries("example.tar", entries)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/usr/bin/example: mode is 755, expected 644"}, problems)
+}
@@ -0,0 +1,82 @@
+package hammer
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Problem is a mistake in a spec found by Lint or ValidateSpec, in the named
+// field
+type Problem struct {
+	Field   string
+	Message string
+}
+
+func (pr Problem) String() string {
+	return fmt.Sprintf("%s: %s", pr.Field, pr.Message)
+}
+
+// Lint checks a loaded package for mistakes that ValidateSpec can't see,
+// because they depend on parents, base specs, project defaults or overrides.
+// The merged package is checked against Schema, including the fields it
+// requires (like the url, hash and hash type of resources, and the dest of
+// targets), and for missing fields, targets without a source and templates
+// that don't render. The parent of a matrix is only checked for templates,
+// since it is never built.
+func (p *Package) Lint() []Problem {
+	problems := []Problem{}
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, Problem{field, fmt.Sprintf(format, args...)})
+	}
+
+	if _, err := p.View(); err != nil {
+		add("template", "%s", err)
+	}
+
+	if !p.MatrixSpec.IsEmpty() {
+		return problems
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{"name", p.Name},
+		{"version", p.Version},
+		{"type", p.Type},
+	} {
+		if field.value == "" {
+			add(field.name, "is required")
+		}
+	}
+
+	for i, target := range p.Targets {
+		if target.Src == "" && target.Type != TargetDir {
+			add(fmt.Sprintf("targets[%d].src", i), "is required")
+		}
+	}
+
+	schemaProblems, err := p.validateSchema()
+	if err != nil {
+		add("spec", "%s", err)
+	}
+	problems = append(problems, schemaProblems...)
+
+	return problems
+}
+
+// validateSchema checks the merged fields of the package against Schema.
+// Children from "multi" are left out, since they are linted on their own.
+func (p *Package) validateSchema() ([]Problem, error) {
+	content, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, "multi")
+
+	return validateSchema(normalizeValue(doc), true), nil
+}
@@ -1,27 +1,73 @@
 package hammer
 
 import (
-	"github.com/Sirupsen/logrus"
-	"github.com/spf13/viper"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
 )
 
+var (
+	// ErrIncludeCycle is returned when specs extend or include each other in a
+	// loop.
+	ErrIncludeCycle = errors.New("spec extends or includes itself")
+
+	// ErrMultipleSpecs is returned when a directory has more than one spec,
+	// like both a spec.yml and a spec.json.
+	ErrMultipleSpecs = errors.New("more than one spec in directory")
+
+	// ErrTOMLFloat is returned when a TOML spec has a float value. Floats lose
+	// their text when read (1.10 becomes 1.1), so they have to be quoted.
+	ErrTOMLFloat = errors.New("TOML specs can't have floats, quote the value as a string")
+)
+
+// SpecNames are the file names that mark a package spec. A spec.json or
+// spec.toml is converted to YAML, so fields mean the same in each.
+var SpecNames = []string{"spec.yml", "spec.yaml", "spec.json", "spec.toml"}
+
+// ConfigName is the name of the project-wide settings file that is looked for
+// in the root of the search path.
+const ConfigName = "hammer.yml"
+
 // Loader looks for Package specs in a given root.
 type Loader struct {
 	// The loader looks for packages in Root
 	Root string
 
-	// The loader looks for files named the value of Indicator to signify a package
+	// The loader looks for files named one of Indicators to signify a package
+	Indicators []string
+
+	// Indicator is the single file name the loader used to look for. When set,
+	// it is used instead of Indicators.
+	//
+	// Deprecated: use Indicators.
 	Indicator string
+
+	// The loader looks for a file named the value of Config in Root. Its
+	// "defaults" section holds field values that every package inherits.
+	Config string
+
+	// Overrides are applied to every package after loading, in order. See
+	// Package.ApplyOverrides.
+	Overrides []Override
 }
 
 // NewLoader returns a Loader with default values set
 func NewLoader(root string) *Loader {
 	return &Loader{
-		Root:      root,
-		Indicator: "spec.yml",
+		Root:       root,
+		Indicators: SpecNames,
+		Config:     ConfigName,
 	}
 }
 
@@ -30,41 +76,343 @@ func (l *Loader) Load() ([]*Package, error) {
 	logrus.WithField("root", l.Root).Info("loading packages")
 	packages := []*Package{}
 
-	err := filepath.Walk(l.Root, func(pathName string, info os.FileInfo, err error) error {
-		if info.IsDir() || info.Name() != l.Indicator {
-			return nil
-		}
+	settings, err := l.settings()
+	if err != nil {
+		logrus.WithError(err).Error("could not read project defaults")
+		return nil, err
+	}
 
-		logrus.WithField("path", pathName).Debug("loading package")
-		content, err := ioutil.ReadFile(pathName)
-		if err != nil {
-			return err
-		}
+	paths, err := l.SpecPaths()
+	if err != nil {
+		return nil, err
+	}
 
-		pkg, err := NewPackageFromYAML(content)
+	for _, pathName := range paths {
+		logrus.WithField("path", pathName).Debug("loading package")
+		pkg, err := l.resolve(pathName, nil)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"path":  pathName,
 				"error": err,
 			}).Warning("could not load package, skipping")
-			return nil
+			continue
 		}
+
+		base, err := newDefaults(settings)
+		if err != nil {
+			return nil, err
+		}
+		if base != nil {
+			pkg, err = inherit(base, pkg)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		path, _ := filepath.Split(pathName)
 		pkg.SpecRoot = path
+		pkg.SpecPath = pathName
 		pkg.OutputRoot = viper.GetString("output")
 		pkg.LogRoot = viper.GetString("logs")
+		pkg.template.Strict = viper.GetBool("strict-templates")
+
+		err = pkg.ApplyOverrides(l.Overrides)
+		if err != nil {
+			return nil, err
+		}
+
+		// a version set by an override wins over version-from
+		if !pkg.overridden("version") {
+			err = pkg.ResolveVersion()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"path":  pathName,
+					"error": err,
+				}).Warning("could not find package version, skipping")
+				continue
+			}
+		}
 		err = pkg.ExpandRecursive(nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
 
+// SpecPaths finds the specs below Root, in lexical order. Each directory may
+// only have one.
+func (l *Loader) SpecPaths() ([]string, error) {
+	paths := []string{}
+	found := map[string]string{}
+	err := filepath.Walk(l.Root, func(pathName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !l.isIndicator(info.Name()) {
+			return nil
+		}
+
+		dir := filepath.Dir(pathName)
+		if other, ok := found[dir]; ok {
+			logrus.WithFields(logrus.Fields{
+				"dir":   dir,
+				"specs": other + ", " + info.Name(),
+			}).Error(ErrMultipleSpecs)
+			return ErrMultipleSpecs
+		}
+		found[dir] = info.Name()
+
+		paths = append(paths, pathName)
 		return nil
 	})
+
+	return paths, err
+}
+
+func (l *Loader) isIndicator(name string) bool {
+	if l.Indicator != "" {
+		return name == l.Indicator
+	}
+
+	for _, indicator := range l.Indicators {
+		if name == indicator {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeSpec returns the content of a spec file as YAML, converting it from
+// JSON or TOML if the file name ends in ".json" or ".toml". Anything else is
+// returned as is.
+func DecodeSpec(name string, content []byte) ([]byte, error) {
+	doc := map[string]interface{}{}
+
+	switch filepath.Ext(name) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err := decoder.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(jsonNumbers(doc))
+
+	case ".toml":
+		_, err := toml.Decode(string(content), &doc)
+		if err != nil {
+			return nil, err
+		}
+		if key, found := tomlFloat(doc, ""); found {
+			logrus.WithFields(logrus.Fields{
+				"path": name,
+				"key":  key,
+			}).Error(ErrTOMLFloat)
+			return nil, ErrTOMLFloat
+		}
+		return yaml.Marshal(doc)
+
+	default:
+		return content, nil
+	}
+}
+
+// tomlFloat finds the first float in a decoded TOML document, returning its
+// dotted key
+func tomlFloat(value interface{}, key string) (string, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return key, true
+
+	case map[string]interface{}:
+		keys := []string{}
+		for inner := range typed {
+			keys = append(keys, inner)
+		}
+		sort.Strings(keys)
+
+		for _, inner := range keys {
+			name := inner
+			if key != "" {
+				name = key + "." + inner
+			}
+			if found, ok := tomlFloat(typed[inner], name); ok {
+				return found, true
+			}
+		}
+
+	case []map[string]interface{}:
+		for i, inner := range typed {
+			if found, ok := tomlFloat(inner, fmt.Sprintf("%s[%d]", key, i)); ok {
+				return found, true
+			}
+		}
+
+	case []interface{}:
+		for i, inner := range typed {
+			if found, ok := tomlFloat(inner, fmt.Sprintf("%s[%d]", key, i)); ok {
+				return found, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// readsAsString tells whether value, written unquoted in a spec, is read back
+// as the same string. Specs are read as YAML 1.1, so "yes", "off", "~", "0755"
+// and "1.10" (among others) are not.
+func readsAsString(value string) bool {
+	var out interface{}
+	err := yaml.Unmarshal([]byte(value), &out)
+	if err != nil {
+		return false
+	}
+
+	s, ok := out.(string)
+	return ok && s == value
+}
+
+// jsonNumbers replaces the numbers in a decoded JSON document with integers,
+// or with their text if they have a fraction or exponent, so that 1.10 is not
+// read as 1.1
+func jsonNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case json.Number:
+		if i, err := typed.Int64(); err == nil {
+			return i
+		}
+		return typed.String()
+
+	case map[string]interface{}:
+		for key, inner := range typed {
+			typed[key] = jsonNumbers(inner)
+		}
+
+	case []interface{}:
+		for i, inner := range typed {
+			typed[i] = jsonNumbers(inner)
+		}
+	}
+
+	return value
+}
+
+// resolve loads the spec at pathName, merging in the files named by its
+// Extends and Include fields. Each included file comes first, in order, then
+// the base named in Extends, and then the spec itself, each overriding the
+// fields set before it in the same way as "multi" children do. Paths are relative to
+// the directory of the spec that names them. The stack of files being resolved
+// is used to detect cycles.
+func (l *Loader) resolve(pathName string, stack []string) (*Package, error) {
+	abs, err := filepath.Abs(pathName)
 	if err != nil {
 		return nil, err
 	}
 
-	return packages, nil
+	for _, seen := range stack {
+		if seen == abs {
+			logrus.WithField("chain", strings.Join(append(stack, abs), " -> ")).Error(ErrIncludeCycle)
+			return nil, ErrIncludeCycle
+		}
+	}
+	stack = append(stack, abs)
+
+	content, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = DecodeSpec(abs, content)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := NewPackageFromYAML(content)
+	if err != nil {
+		return spec, err
+	}
+
+	if spec.Extends == "" && len(spec.Include) == 0 {
+		return spec, nil
+	}
+
+	dir := filepath.Dir(abs)
+	base := NewPackage()
+	for _, include := range spec.Include {
+		fragment, err := l.resolve(filepath.Join(dir, include), stack)
+		if err != nil {
+			return base, err
+		}
+
+		err = base.mergeFrom(fragment)
+		if err != nil {
+			return base, err
+		}
+	}
+
+	if spec.Extends != "" {
+		parent, err := l.resolve(filepath.Join(dir, spec.Extends), stack)
+		if err != nil {
+			return base, err
+		}
+
+		err = base.mergeFrom(parent)
+		if err != nil {
+			return base, err
+		}
+	}
+
+	base, err = inherit(base, spec)
+	if err != nil {
+		return base, err
+	}
+
+	base.Extends = ""
+	base.Include = nil
+
+	return base, nil
+}
+
+// settings reads the project settings file in Root, returning nil if there is
+// none.
+func (l *Loader) settings() ([]byte, error) {
+	content, err := ioutil.ReadFile(filepath.Join(l.Root, l.Config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// newDefaults reads the "defaults" section of the project settings into a new
+// Package, or returns nil if there are no settings. It is read straight into
+// the Package so that fields keep the text written in the file.
+func newDefaults(settings []byte) (*Package, error) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	config := struct {
+		Defaults *Package `yaml:"defaults"`
+	}{NewPackage()}
+	err := yaml.Unmarshal(settings, &config)
+	if err != nil {
+		return nil, err
+	}
+	return config.Defaults, nil
+}
+
+// inherit merges the fields set in spec on top of base, and returns base.
+func inherit(base, spec *Package) (*Package, error) {
+	err := base.mergeFrom(spec)
+	if err != nil {
+		return base, err
+	}
+
+	base.logger = spec.logger.WithField("name", base.Name)
+	return base, nil
 }
@@ -0,0 +1,280 @@
+package hammer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoaderFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	specs := map[string]string{
+		"json/spec.json": `{
+	"name": "consul",
+	"version": "0.5.2",
+	"type": "rpm",
+	"depends": ["glibc"],
+	"targets": [{"src": "consul", "dest": "/usr/bin/", "mode": 755}]
+}`,
+		"toml/spec.toml": `name = "consul"
+version = "0.5.2"
+type = "rpm"
+depends = ["glibc"]
+
+[[targets]]
+src = "consul"
+dest = "/usr/bin/"
+mode = 755
+`,
+		"yaml/spec.yaml": `name: consul
+version: 0.5.2
+type: rpm
+depends: [glibc]
+targets:
+- {src: consul, dest: /usr/bin/, mode: 755}
+`,
+	}
+	for name, spec := range specs {
+		assert.Nil(t, os.MkdirAll(path.Join(dir, path.Dir(name)), 0755))
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte(spec), 0644))
+	}
+
+	pkgs, err := NewLoader(dir).Load()
+	assert.Nil(t, err)
+	assert.Len(t, pkgs, 3)
+	for _, p := range pkgs {
+		assert.Equal(t, "consul", p.Name, p.SpecPath)
+		assert.Equal(t, "0.5.2", p.Version, p.SpecPath)
+		assert.Equal(t, []string{"glibc"}, p.Depends, p.SpecPath)
+		if assert.Len(t, p.Targets, 1, p.SpecPath) {
+			assert.Equal(t, "755", p.Targets[0].Mode, p.SpecPath)
+		}
+	}
+
+	// only one spec per directory
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "json", "spec.yml"), []byte("name: consul\n"), 0644))
+	_, err = NewLoader(dir).Load()
+	assert.Equal(t, ErrMultipleSpecs, err)
+}
+
+func TestLoaderDefaultsKeepVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, ConfigName), []byte(`defaults:
+  type: rpm
+  vars:
+    release: 1.10
+    mode: 0755
+    debug: yes
+`), 0644))
+	assert.Nil(t, os.MkdirAll(path.Join(dir, "foo"), 0755))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "foo", "spec.yml"), []byte("name: foo\nversion: 1.0.0\n"), 0644))
+
+	pkgs, err := NewLoader(dir).Load()
+	assert.Nil(t, err)
+	if assert.Len(t, pkgs, 1) {
+		assert.Equal(t, "rpm", pkgs[0].Type)
+		assert.Equal(t, Vars{"release": "1.10", "mode": "0755", "debug": "yes"}, pkgs[0].Vars)
+	}
+}
+
+func TestDecodeSpecJSON(t *testing.T) {
+	content, err := DecodeSpec("spec.json", []byte(`{
+	"name": "smile-\uD83D\uDE00",
+	"url": "http:\/\/example.com\/smile",
+	"version": "1.0",
+	"vars": {"release": 1.10, "port": 8500, "big": 1e3, "debug": true}
+}`))
+	assert.Nil(t, err)
+
+	p, err := NewPackageFromYAML(content)
+	assert.Nil(t, err)
+	assert.Equal(t, "smile-\U0001F600", p.Name)
+	assert.Equal(t, "http://example.com/smile", p.URL)
+	assert.Equal(t, "1.0", p.Version)
+	assert.Equal(t, Vars{"release": "1.10", "port": "8500", "big": "1e3", "debug": "true"}, p.Vars)
+
+	_, err = DecodeSpec("spec.json", []byte(`{"name": `))
+	assert.NotNil(t, err)
+}
+
+func TestDecodeSpecTOML(t *testing.T) {
+	content, err := DecodeSpec("spec.toml", []byte(`name = "consul"
+version = "1.10"
+
+[vars]
+release = "1.10"
+port = 8500
+debug = true
+`))
+	assert.Nil(t, err)
+
+	p, err := NewPackageFromYAML(content)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.10", p.Version)
+	assert.Equal(t, Vars{"release": "1.10", "port": "8500", "debug": "true"}, p.Vars)
+
+	// floats would lose their text, so they have to be quoted
+	for _, spec := range []string{
+		"name = \"consul\"\n[vars]\nrelease = 1.10\n",
+		"name = \"consul\"\n[vars]\nreleases = [1.0, 1.10]\n",
+		"name = \"consul\"\n[[targets]]\ndest = \"/usr/bin/\"\nmode = 7.55\n",
+		"big = 1e3\n",
+	} {
+		_, err = DecodeSpec("spec.toml", []byte(spec))
+		assert.Equal(t, ErrTOMLFloat, err, spec)
+	}
+
+	_, err = DecodeSpec("spec.toml", []byte("name = "))
+	assert.NotNil(t, err)
+}
+
+func TestLoaderIndicator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a/spec.yml", "b/package.yml"} {
+		assert.Nil(t, os.MkdirAll(path.Join(dir, path.Dir(name)), 0755))
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte("name: "+path.Dir(name)+"\n"), 0644))
+	}
+
+	l := NewLoader(dir)
+	paths, err := l.SpecPaths()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{path.Join(dir, "a/spec.yml")}, paths)
+
+	// the deprecated single name is used instead of Indicators
+	l.Indicator = "package.yml"
+	paths, err = l.SpecPaths()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{path.Join(dir, "b/package.yml")}, paths)
+
+	paths, err = (&Loader{Root: dir, Indicator: "spec.yml"}).SpecPaths()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{path.Join(dir, "a/spec.yml")}, paths)
+}
+
+func TestLoaderMergeOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		ConfigName: `defaults:
+  license: MPL
+  vendor: defaults
+  description: defaults
+  depends: [defaults]
+  vars: {a: defaults, b: defaults, c: defaults, d: defaults}
+`,
+		"common/include.yml": `vendor: include
+description: include
+depends: [include]
+vars: {b: include, c: include, d: include}
+`,
+		"common/base.yml": `description: extends
+depends: [extends-a, extends-b]
+vars: {c: extends, d: extends}
+`,
+		"consul/spec.yml": `extends: ../common/base.yml
+include: [../common/include.yml]
+name: consul
+version: 0.5.2
+vars: {d: spec}
+`,
+	}
+	for name, content := range files {
+		assert.Nil(t, os.MkdirAll(path.Join(dir, path.Dir(name)), 0755))
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	pkgs, err := NewLoader(dir).Load()
+	assert.Nil(t, err)
+	if !assert.Len(t, pkgs, 1) {
+		return
+	}
+	p := pkgs[0]
+
+	// defaults < include < extends < spec
+	assert.Equal(t, "MPL", p.License)
+	assert.Equal(t, "include", p.Vendor)
+	assert.Equal(t, "extends", p.Description)
+
+	// maps are merged key by key, lists are replaced as a whole
+	assert.Equal(t, Vars{"a": "defaults", "b": "include", "c": "extends", "d": "spec"}, p.Vars)
+	assert.Equal(t, []string{"extends-a", "extends-b"}, p.Depends)
+
+	assert.Equal(t, "", p.Extends)
+	assert.Nil(t, p.Include)
+}
+
+func TestLoaderIncludeCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	spec := path.Join(dir, "spec.yml")
+	base := path.Join(dir, "base.yml")
+	assert.Nil(t, ioutil.WriteFile(spec, []byte("extends: base.yml\nname: consul\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(base, []byte("include: [spec.yml]\nvendor: hammer\n"), 0644))
+
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	_, err = NewLoader(dir).resolve(spec, nil)
+	assert.Equal(t, ErrIncludeCycle, err)
+
+	// the whole chain is reported
+	assert.Contains(t, buf.String(), spec+" -> "+base+" -> "+spec)
+}
+
+func TestLoaderOverridesBeatVersionFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-loader-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	specs := map[string]string{
+		"found/VERSION":    "1.0.0\n",
+		"found/spec.yml":   "name: found\nversion-from: {file: VERSION}\n",
+		"missing/spec.yml": "name: missing\nversion-from: {file: VERSION}\n",
+	}
+	for name, spec := range specs {
+		assert.Nil(t, os.MkdirAll(path.Join(dir, path.Dir(name)), 0755))
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte(spec), 0644))
+	}
+
+	versions := func(overrides ...Override) map[string]string {
+		l := NewLoader(dir)
+		l.Overrides = overrides
+		pkgs, err := l.Load()
+		assert.Nil(t, err)
+
+		versions := map[string]string{}
+		for _, p := range pkgs {
+			versions[p.Name] = p.Version
+		}
+		return versions
+	}
+
+	// without an override, a spec whose version can't be found is skipped
+	assert.Equal(t, map[string]string{"found": "1.0.0"}, versions())
+
+	set, err := ParseOverride("version=2.0.0", "--set")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"found": "2.0.0", "missing": "2.0.0"}, versions(set))
+
+	env := EnvOverrides([]string{"HAMMER_VAR_CHANNEL=beta"})
+	assert.Equal(t, map[string]string{"found": "1.0.0"}, versions(env...))
+}
@@ -0,0 +1,110 @@
+package hammer
+
+import (
+	"sort"
+	"strings"
+)
+
+// Matrix generates a child package for every combination of values of its
+// named axes, like the build matrix of a CI system. Combinations matching all
+// of the keys in an Exclude entry are skipped, and Include entries are added
+// as extra combinations.
+type Matrix struct {
+	Axes    map[string][]string `yaml:",inline"`
+	Exclude []map[string]string `yaml:"exclude,omitempty"`
+	Include []map[string]string `yaml:"include,omitempty"`
+}
+
+// IsEmpty is true when the matrix would not generate any packages
+func (m Matrix) IsEmpty() bool {
+	return len(m.Axes) == 0 && len(m.Include) == 0
+}
+
+// Combinations returns the Cartesian product of the axes, minus excluded and
+// plus included combinations. Axes are expanded in alphabetical order, so the
+// result is stable.
+func (m Matrix) Combinations() []map[string]string {
+	names := []string{}
+	for name := range m.Axes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []map[string]string{}
+	if len(names) > 0 {
+		combinations = append(combinations, map[string]string{})
+	}
+
+	for _, name := range names {
+		next := []map[string]string{}
+		for _, combination := range combinations {
+			for _, value := range m.Axes[name] {
+				extended := map[string]string{name: value}
+				for k, v := range combination {
+					extended[k] = v
+				}
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+
+	out := []map[string]string{}
+	for _, combination := range combinations {
+		if !m.excluded(combination) {
+			out = append(out, combination)
+		}
+	}
+
+	for _, include := range m.Include {
+		if !containsCombination(out, include) {
+			out = append(out, include)
+		}
+	}
+
+	return out
+}
+
+func (m Matrix) excluded(combination map[string]string) bool {
+	for _, exclude := range m.Exclude {
+		if len(exclude) > 0 && matchesCombination(combination, exclude) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCombination is true when every key in filter has the same value in
+// combination
+func matchesCombination(combination, filter map[string]string) bool {
+	for k, v := range filter {
+		if combination[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func containsCombination(combinations []map[string]string, combination map[string]string) bool {
+	for _, existing := range combinations {
+		if len(existing) == len(combination) && matchesCombination(existing, combination) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeCombination formats a combination as "a=1,b=2"
+func describeCombination(combination map[string]string) string {
+	parts := []string{}
+	for k, v := range combination {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// combinationName describes a combination for use in file names
+func combinationName(combination map[string]string) string {
+	return strings.NewReplacer(",", "-", "=", "_", "/", "_").Replace(describeCombination(combination))
+}
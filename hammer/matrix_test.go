@@ -0,0 +1,102 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	cases := []struct {
+		name     string
+		matrix   Matrix
+		expected []map[string]string
+	}{
+		{
+			name:     "empty",
+			matrix:   Matrix{},
+			expected: []map[string]string{},
+		},
+		{
+			name: "product of the axes, in alphabetical order",
+			matrix: Matrix{Axes: map[string][]string{
+				"version": {"1", "2"},
+				"arch":    {"amd64", "arm"},
+			}},
+			expected: []map[string]string{
+				{"arch": "amd64", "version": "1"},
+				{"arch": "amd64", "version": "2"},
+				{"arch": "arm", "version": "1"},
+				{"arch": "arm", "version": "2"},
+			},
+		},
+		{
+			name: "exclude and include",
+			matrix: Matrix{
+				Axes: map[string][]string{
+					"version": {"1", "2"},
+					"arch":    {"amd64", "arm"},
+				},
+				Exclude: []map[string]string{{"arch": "arm", "version": "1"}, {}},
+				Include: []map[string]string{
+					{"arch": "amd64", "version": "2"},
+					{"arch": "386", "version": "1"},
+				},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64", "version": "1"},
+				{"arch": "amd64", "version": "2"},
+				{"arch": "arm", "version": "2"},
+				{"arch": "386", "version": "1"},
+			},
+		},
+		{
+			name:     "an axis without values has no combinations",
+			matrix:   Matrix{Axes: map[string][]string{"arch": {"amd64"}, "version": {}}},
+			expected: []map[string]string{},
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, c.matrix.Combinations(), c.name)
+	}
+}
+
+func TestExpandMatrix(t *testing.T) {
+	parent, err := NewPackageFromYAML([]byte(`
+name: consul
+version: "{{.Matrix.version}}"
+architecture: "{{.Matrix.arch}}"
+scripts: {build: make}
+matrix:
+  arch: [amd64, arm]
+  version: [0.5.2]
+  exclude:
+  - arch: arm
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, parent.ExpandRecursive(nil))
+
+	if assert.Len(t, parent.Children, 1) {
+		child := parent.Children[0]
+		assert.Equal(t, map[string]string{"arch": "amd64", "version": "0.5.2"}, child.Matrix)
+		assert.Equal(t, Scripts{"build": "make"}, child.Scripts)
+		assert.True(t, child.MatrixSpec.IsEmpty())
+
+		version, err := child.template.RenderField("version", child.Version)
+		assert.Nil(t, err)
+		assert.Equal(t, "0.5.2", version.String())
+	}
+
+	// errors in the children stop the expansion
+	parent, err = NewPackageFromYAML([]byte(`
+name: consul
+matrix:
+  arch: [amd64]
+multi:
+- name: consul-ui
+  merge: {nope: replace}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrUnknownMergeField, parent.ExpandRecursive(nil))
+}
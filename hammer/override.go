@@ -0,0 +1,228 @@
+package hammer
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrBadOverride is returned when an override is not of the form
+	// "key=value".
+	ErrBadOverride = errors.New("override should look like key=value")
+
+	// ErrUnknownOverride is returned when an override names a field that is
+	// not in the spec.
+	ErrUnknownOverride = errors.New("override given for unknown field")
+)
+
+// EnvOverridePrefix starts the names of environment variables that override
+// spec fields
+const EnvOverridePrefix = "HAMMER_VAR_"
+
+// Override sets a spec field from outside the spec, like the command line. Key
+// is the field name as written in the spec, and can be a dotted path into a
+// map or nested section, like "vars.channel".
+type Override struct {
+	Key    string
+	Value  string
+	Source string
+
+	// literal values are used as-is instead of being read as YAML
+	literal bool
+}
+
+// ParseOverride reads an override from "key=value". The value is read as
+// YAML where it can be, so "[a, b]" is a list, and anything else is used as a
+// plain string. See Override.yaml.
+func ParseOverride(arg, source string) (Override, error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Override{}, ErrBadOverride
+	}
+
+	return Override{Key: parts[0], Value: parts[1], Source: source}, nil
+}
+
+// ParseFileOverride reads an override from "key=path". The value is the
+// content of the file at path.
+func ParseFileOverride(arg, source string) (Override, error) {
+	override, err := ParseOverride(arg, source)
+	if err != nil {
+		return override, err
+	}
+
+	content, err := ioutil.ReadFile(override.Value)
+	if err != nil {
+		return override, err
+	}
+
+	override.Source += " " + override.Value
+	override.Value = string(content)
+	override.literal = true
+
+	return override, nil
+}
+
+// EnvOverrides reads overrides of vars from environment variables (as given by
+// os.Environ) starting with EnvOverridePrefix. The rest of the name is
+// lowercased and "__" separates path elements, so HAMMER_VAR_CHANNEL sets
+// "vars.channel" and HAMMER_VAR_URLS__X86_64 sets "vars.urls.x86_64". The
+// result is sorted by key.
+func EnvOverrides(environ []string) []Override {
+	overrides := []Override{}
+
+	for _, env := range environ {
+		if !strings.HasPrefix(env, EnvOverridePrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(env, EnvOverridePrefix), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+
+		path := append([]string{"vars"}, strings.Split(strings.ToLower(parts[0]), "__")...)
+
+		overrides = append(overrides, Override{
+			Key:    strings.Join(path, "."),
+			Value:  parts[1],
+			Source: EnvOverridePrefix + parts[0],
+		})
+	}
+
+	sort.Sort(overridesByKey(overrides))
+	return overrides
+}
+
+type overridesByKey []Override
+
+func (o overridesByKey) Len() int           { return len(o) }
+func (o overridesByKey) Less(i, j int) bool { return o[i].Key < o[j].Key }
+func (o overridesByKey) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
+// yaml renders the override as a spec fragment that only sets its key. Unless
+// literal is set, a value that reads as a YAML scalar, or as a flow style list
+// or map like "[a, b]", is kept as that YAML, so it means the same as it would
+// in a spec. Anything else is written as a plain string.
+func (o Override) yaml(literal bool) ([]byte, error) {
+	var value interface{} = o.Value
+	if !literal {
+		if node := overrideNode(o.Value); node != nil {
+			value = node
+		}
+	}
+
+	path := strings.Split(o.Key, ".")
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return yaml.Marshal(value)
+}
+
+// overrideNode reads a single line value as YAML, returning nil if it is not a
+// scalar or flow style collection, or if it has comments that would be lost.
+func overrideNode(value string) *yaml.Node {
+	if strings.Contains(value, "\n") {
+		return nil
+	}
+
+	doc := yaml.Node{}
+	err := yaml.Unmarshal([]byte(value), &doc)
+	if err != nil || len(doc.Content) != 1 || hasComments(&doc) {
+		return nil
+	}
+
+	node := doc.Content[0]
+	if node.Kind != yaml.ScalarNode && node.Style&yaml.FlowStyle == 0 {
+		return nil
+	}
+	return node
+}
+
+func hasComments(node *yaml.Node) bool {
+	if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasComments(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// fragment reads the override as a Package that only has its key set. If the
+// value doesn't fit the field as YAML it is tried again as a plain string.
+func (o Override) fragment() (*Package, error) {
+	if !o.literal {
+		content, err := o.yaml(false)
+		if err != nil {
+			return nil, err
+		}
+
+		if other, err := NewPackageFromYAML(content); err == nil {
+			return other, nil
+		}
+	}
+
+	content, err := o.yaml(true)
+	if err != nil {
+		return nil, err
+	}
+	return NewPackageFromYAML(content)
+}
+
+// ApplyOverrides sets fields from overrides, in order, so later overrides win.
+// Values are merged in the same way as inherited fields, following the
+// package's merge strategies. Applied overrides are recorded in Overrides.
+func (p *Package) ApplyOverrides(overrides []Override) error {
+	known := map[string]bool{}
+	for _, field := range yamlFields(reflect.TypeOf(*p)) {
+		known[field.Name] = true
+	}
+
+	for _, override := range overrides {
+		logger := p.logger.WithFields(logrus.Fields{
+			"key":    override.Key,
+			"source": override.Source,
+		})
+
+		if !known[strings.Split(override.Key, ".")[0]] {
+			logger.Error(ErrUnknownOverride)
+			return ErrUnknownOverride
+		}
+
+		other, err := override.fragment()
+		if err != nil {
+			logger.WithError(err).Error("could not read override")
+			return err
+		}
+
+		err = p.mergeFrom(other)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("applied override")
+		p.Overrides = append(p.Overrides, override)
+	}
+
+	return nil
+}
+
+// overridden tells whether an applied override set the field key, or a field
+// inside it
+func (p *Package) overridden(key string) bool {
+	for _, override := range p.Overrides {
+		if override.Key == key || strings.HasPrefix(override.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
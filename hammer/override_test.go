@@ -0,0 +1,97 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte("name: a\nversion: 1.0\nvars: {channel: stable, other: x}"))
+	assert.Nil(t, err)
+
+	env := EnvOverrides([]string{
+		"PATH=/bin",
+		"HAMMER_VAR_CHANNEL=env",
+		"HAMMER_VAR_VERSION=2.0",
+		"HAMMER_VAR_URLS__X86_64=http://example.com",
+	})
+	assert.Equal(t, []string{"vars.channel", "vars.urls.x86_64", "vars.version"}, []string{env[0].Key, env[1].Key, env[2].Key})
+
+	set := []string{"version=3.0", "vars.channel=beta", "depends=[x, y]", "vars.url=http://a: b", "extra-args=--foo"}
+	overrides := env
+	for _, arg := range set {
+		override, err := ParseOverride(arg, "--set")
+		assert.Nil(t, err)
+		overrides = append(overrides, override)
+	}
+
+	assert.Nil(t, p.ApplyOverrides(overrides))
+	assert.Equal(t, "3.0", p.Version)
+	assert.Equal(t, "--foo", p.ExtraArgs)
+	assert.Equal(t, []string{"x", "y"}, p.Depends)
+	assert.Equal(t, Vars{
+		"channel": "beta",
+		"other":   "x",
+		"url":     "http://a: b",
+		"version": "2.0",
+		"urls":    map[string]interface{}{"x86_64": "http://example.com"},
+	}, p.Vars)
+	assert.Len(t, p.Overrides, len(overrides))
+
+	_, err = ParseOverride("version", "--set")
+	assert.Equal(t, ErrBadOverride, err)
+
+	assert.Equal(t, ErrUnknownOverride, p.ApplyOverrides([]Override{{Key: "nope", Value: "1"}}))
+}
+
+func TestOverrideValues(t *testing.T) {
+	cases := []struct {
+		key   string
+		value string
+		out   interface{}
+	}{
+		{"vars.x", "1.10", "1.10"},
+		{"vars.x", "a: b", "a: b"},
+		{"vars.x", "a:b", "a:b"},
+		{"vars.x", "a #b", "a #b"},
+		{"vars.x", "#b", "#b"},
+		{"vars.x", "- a", "- a"},
+		{"vars.x", "-a", "-a"},
+		{"vars.x", "a\nversion: 9", "a\nversion: 9"},
+		{"vars.x", "[a, b]", []interface{}{"a", "b"}},
+		{"vars.x", "{a: b}", map[string]interface{}{"a": "b"}},
+		{"vars.x", "", ""},
+		{"extra-args", "- -foo: bar", "- -foo: bar"},
+		{"depends", "[a, b]", []string{"a", "b"}},
+		{"depends", "- a", nil},
+	}
+
+	for _, c := range cases {
+		p, err := NewPackageFromYAML([]byte("name: a\nversion: 1.0\n"))
+		assert.Nil(t, err)
+
+		err = p.ApplyOverrides([]Override{{Key: c.key, Value: c.value}})
+		switch c.key {
+		case "vars.x":
+			assert.Nil(t, err, c.value)
+			assert.Equal(t, c.out, p.Vars["x"], c.value)
+			assert.Equal(t, "1.0", p.Version, c.value)
+		case "extra-args":
+			assert.Nil(t, err, c.value)
+			assert.Equal(t, c.out, p.ExtraArgs, c.value)
+		case "depends":
+			if c.out == nil {
+				assert.NotNil(t, err, c.value)
+			} else if assert.Nil(t, err, c.value) {
+				assert.Equal(t, c.out, p.Depends, c.value)
+			}
+		}
+	}
+
+	// values from --set-file are always used as-is
+	p := NewPackage()
+	override := Override{Key: "vars.notes", Value: "line one\n- two: #3\n", literal: true}
+	assert.Nil(t, p.ApplyOverrides([]Override{override}))
+	assert.Equal(t, "line one\n- two: #3\n", p.Vars["notes"])
+}
@@ -2,6 +2,7 @@ package hammer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"path"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/asteris-llc/hammer/hammer/cache"
@@ -16,13 +18,40 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	// ErrNoSharedBuild is returned when a package wants to share a build, but
+	// none of its parents do a build of their own.
+	ErrNoSharedBuild = errors.New("shared-build is set, but there is no parent build to share")
+)
+
 // Target describes the output of a build. It has a source (Src) and a
 // destination (Dest), and can be templated and marked as a config file.
+//
+// Src may be a glob pattern, in which case every match is installed into the
+// Dest directory. Files matching any of the Exclude patterns are left out, and
+// a Src that matches nothing is an error unless the target is Optional.
+//
+// When Template is set on a directory, every file below it is rendered (or
+// only those matching TemplateInclude, minus those matching TemplateExclude)
+// and the directory layout is kept.
+//
+// Type may be "file" (the default), "dir" to create an empty directory at Dest,
+// or "symlink" to create a link at Dest pointing to Src. Mode, User and Group
+// set the permissions of the installed file.
 type Target struct {
-	Src      string `yaml:"src"`
-	Dest     string `yaml:"dest"`
-	Template bool   `yaml:"template"`
-	Config   bool   `yaml:"config"`
+	Src      string   `yaml:"src,omitempty"`
+	Dest     string   `yaml:"dest"`
+	Template bool     `yaml:"template,omitempty"`
+	Config   bool     `yaml:"config,omitempty"`
+	Type     string   `yaml:"type,omitempty"`
+	Mode     string   `yaml:"mode,omitempty"`
+	User     string   `yaml:"user,omitempty"`
+	Group    string   `yaml:"group,omitempty"`
+	Exclude  []string `yaml:"exclude,omitempty"`
+	Optional bool     `yaml:"optional,omitempty"`
+
+	TemplateInclude []string `yaml:"template-include,omitempty"`
+	TemplateExclude []string `yaml:"template-exclude,omitempty"`
 }
 
 // Attr describes the permissions, Owner and Group for a file
@@ -54,18 +83,61 @@ type Package struct {
 	Vendor       string     `yaml:"vendor,omitempty"`
 	Version      string     `yaml:"version,omitempty"`
 
+	// VersionFrom derives Version from git, a file or a command. Iteration can
+	// also be "auto" to bump the iteration of the last build.
+	VersionFrom VersionFrom `yaml:"version-from,omitempty"`
+
+	// Upstream is where to look for new releases, see `hammer outdated`
+	Upstream Upstream `yaml:"upstream,omitempty"`
+
+	// Verification adds assertions that are checked against the built package
+	Verification Verification `yaml:"verify,omitempty"`
+
+	// system setup that is turned into install scripts
+	Users       []User      `yaml:"users,omitempty"`
+	Groups      []Group     `yaml:"groups,omitempty"`
+	Directories []Directory `yaml:"directories,omitempty"`
+	Services    []Service   `yaml:"services,omitempty"`
+
+	// Extends and Include name other YAML files (relative to this one) whose
+	// fields are merged in underneath this spec's when loading.
+	Extends string   `yaml:"extends,omitempty"`
+	Include []string `yaml:"include,omitempty"`
+
+	// Merge sets how fields are combined with the ones inherited from a parent
+	// (in "multi"), base spec or project defaults. Keys are field names as
+	// written in the spec, values are "replace", "append" or "deep-merge".
+	Merge map[string]string `yaml:"merge,omitempty"`
+
 	// Multi parametrizes builds by expanding recursively. This information is
 	// then moved to Parent and Children.
 	Multi []*Package `yaml:"multi,omitempty"`
 
+	// MatrixSpec parametrizes builds by generating a child for every
+	// combination of its axes. The parent of a matrix is not built itself.
+	// Each child gets its combination of values in Matrix.
+	MatrixSpec Matrix            `yaml:"matrix,omitempty"`
+	Matrix     map[string]string `yaml:"-"`
+
+	// SharedBuild makes a child use its parent's BuildRoot instead of setting
+	// up and building on its own. The parent's build output is only read, so
+	// several children can package different parts of a single build.
+	SharedBuild bool `yaml:"shared-build,omitempty"`
+
+	// Subpackages are extra packages made from the same build, each sharing
+	// it the same way as a child with SharedBuild.
+	Subpackages []Subpackage `yaml:"subpackages,omitempty"`
+
 	// various roots
-	BuildRoot  string `yaml:"-"`
-	Empty      string `yaml:"-"`
-	OutputRoot string `yaml:"-"`
-	ScriptRoot string `yaml:"-"`
-	SpecRoot   string `yaml:"-"`
-	TargetRoot string `yaml:"-"`
-	LogRoot    string `yaml:"-"`
+	BuildRoot   string `yaml:"-"`
+	Empty       string `yaml:"-"`
+	OutputRoot  string `yaml:"-"`
+	ScriptRoot  string `yaml:"-"`
+	SpecRoot    string `yaml:"-"`
+	SpecPath    string `yaml:"-"`
+	StagingRoot string `yaml:"-"`
+	TargetRoot  string `yaml:"-"`
+	LogRoot     string `yaml:"-"`
 
 	// graph of builds
 	Parent   *Package   `yaml:"-"`
@@ -74,14 +146,21 @@ type Package struct {
 	// information about the machine doing the building
 	CPUs int `yaml:"-"`
 
+	// Artifacts are the files produced by the package stage
+	Artifacts []Artifact `yaml:"-"`
+
+	// Overrides are the values set from outside the spec when loading
+	Overrides []Override `yaml:"-"`
+
 	// Extra variables that will be available to templates
-	Vars            map[string]string `yaml:"vars,omitempty"`
+	Vars            Vars `yaml:"vars,omitempty"`
 	cache           cache.Cache
 	fpm             *FPM
 	logger          *logrus.Entry
 	scriptLocations map[string]string
 	template        *Template
-	StreamLogs      bool `yaml:"-"`
+	buildUsers      int32 // packages still using BuildRoot, see releaseBuildRoot
+	StreamLogs      bool  `yaml:"-"`
 }
 
 // NewPackage sets up defaults for build machine information, the logger, and
@@ -142,11 +221,21 @@ func (p *Package) SetCache(cache cache.Cache) {
 // BuildAndPackage is the main function you'll want to call after loading a
 // Package. It takes care of all the stages of the build, including setup and
 // cleanup.
-func (p *Package) BuildAndPackage() error {
+func (p *Package) BuildAndPackage() (err error) {
+	if !p.MatrixSpec.IsEmpty() {
+		p.logger.Debug("package has a build matrix, only building its children")
+		return nil
+	}
+
 	defer func() {
 		// TODO: remove the call to viper here in favor of having another piece
 		// of configuration in Package
 		if !viper.GetBool("skip-cleanup") {
+			// children sharing our build won't run if we failed
+			if err != nil {
+				p.releaseBuildRoot(p.sharedBuildUsers())
+			}
+
 			err := p.Cleanup()
 			if err != nil {
 				p.logger.Warn("did not clean up successfully, there may be residual files in your system")
@@ -163,6 +252,7 @@ func (p *Package) BuildAndPackage() error {
 		{"setup", p.Setup},
 		{"build", p.Build},
 		{"package", p.Package},
+		{"verify", p.Verify},
 	}
 
 	for _, stage := range stages {
@@ -186,13 +276,36 @@ func (p *Package) BuildAndPackage() error {
 // - getting the sources and storing them
 // - rendering and writing all the scripts to disk
 // - setting up the build logging
-// - making sure FPM has an environment it can run in
+//
+// Packages with SharedBuild use the BuildRoot of the parent doing the build,
+// and skip downloading resources.
 func (p *Package) Setup() error {
+	err := p.resolveIteration()
+	if err != nil {
+		return err
+	}
+
 	roots := map[string]*string{
-		"build":  &p.BuildRoot,
-		"script": &p.ScriptRoot,
-		"target": &p.TargetRoot,
-		"empty":  &p.Empty,
+		"build":   &p.BuildRoot,
+		"script":  &p.ScriptRoot,
+		"staging": &p.StagingRoot,
+		"target":  &p.TargetRoot,
+		"empty":   &p.Empty,
+	}
+
+	if p.SharedBuild {
+		owner := p.buildOwner()
+		if owner == nil || !owner.MatrixSpec.IsEmpty() {
+			p.logger.WithError(ErrNoSharedBuild).Error("could not find a build to share")
+			return ErrNoSharedBuild
+		}
+
+		p.logger.WithField("parent", owner.Name).Debug("sharing build root with parent")
+		p.BuildRoot = owner.BuildRoot
+		delete(roots, "build")
+	} else {
+		// the build root is removed once every child sharing it is done
+		atomic.StoreInt32(&p.buildUsers, int32(1+p.sharedBuildUsers()))
 	}
 
 	for name, root := range roots {
@@ -208,26 +321,22 @@ func (p *Package) Setup() error {
 		*root = dir
 	}
 
-	// get the sources and store them in the temporary directory
-	err := p.downloadResources()
-	if err != nil {
-		return err
+	// get the sources and store them in the temporary directory. Shared builds
+	// already have them in the parent's.
+	if !p.SharedBuild {
+		err = p.downloadResources()
+		if err != nil {
+			return err
+		}
 	}
 
-	// render scripts to disk
-	locations, err := p.Scripts.RenderAndWriteAll(p)
+	// render scripts (including generated ones) to disk
+	locations, err := p.allScripts().RenderAndWriteAll(p)
 	if err != nil {
 		return err
 	}
 	p.scriptLocations = locations
 
-	// create an FPM instance
-	fpm, err := NewFPM(p)
-	if err != nil {
-		return err
-	}
-	p.fpm = fpm
-
 	return nil
 }
 
@@ -279,13 +388,13 @@ func (p *Package) downloadResources() error {
 
 // Cleanup is basically the opposite function of Setup, although it doesn't have
 // nearly as much work to do. It just recursively removes the temporary
-// directories.
+// directories. The build root is kept until every package sharing it is done.
 func (p *Package) Cleanup() error {
 	roots := map[string]string{
-		"build":  p.BuildRoot,
-		"script": p.ScriptRoot,
-		"target": p.TargetRoot,
-		"empty":  p.Empty,
+		"script":  p.ScriptRoot,
+		"staging": p.StagingRoot,
+		"target":  p.TargetRoot,
+		"empty":   p.Empty,
 	}
 
 	for root, dest := range roots {
@@ -299,13 +408,62 @@ func (p *Package) Cleanup() error {
 		}
 	}
 
-	return nil
+	return p.releaseBuildRoot(1)
+}
+
+// buildOwner returns the package whose BuildRoot this package uses: either
+// itself or, for shared builds, the nearest parent that does its own build.
+func (p *Package) buildOwner() *Package {
+	owner := p
+	for owner != nil && owner.SharedBuild {
+		owner = owner.Parent
+	}
+	return owner
+}
+
+// sharedBuildUsers counts the descendants that will share this package's
+// BuildRoot
+func (p *Package) sharedBuildUsers() int {
+	count := 0
+	for _, child := range p.Children {
+		if child.SharedBuild {
+			count += 1 + child.sharedBuildUsers()
+		}
+	}
+	return count
+}
+
+// releaseBuildRoot marks n users of the shared BuildRoot as done with it, and
+// removes it when there are none left.
+func (p *Package) releaseBuildRoot(n int) error {
+	owner := p.buildOwner()
+	if owner == nil || owner.BuildRoot == "" || n == 0 {
+		return nil
+	}
+
+	if atomic.AddInt32(&owner.buildUsers, -int32(n)) > 0 {
+		return nil
+	}
+
+	err := os.RemoveAll(owner.BuildRoot)
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"error": err,
+			"root":  "build",
+		}).Error("could not remove root during cleanup")
+	}
+	return err
 }
 
 // Build runs the build script in the specified shell and build directory. If
 // there is not a build script specified for the package, Build is basically a
 // no-op but will warn about missing the script.
 func (p *Package) Build() error {
+	if p.SharedBuild {
+		p.logger.Debug("sharing parent build, skipping build stage")
+		return nil
+	}
+
 	// perform the build
 	buildScript, ok := p.scriptLocations["build"]
 	if !ok {
@@ -330,7 +488,7 @@ func (p *Package) Build() error {
 		return err
 	}
 
-	file, err := NewFileConsumer(logger, p.LogRoot, p.Name)
+	file, err := NewFileConsumer(logger, p.LogRoot, p.logName())
 	if err != nil {
 		p.logger.WithError(err).Error("could not start a file log consumer")
 		return err
@@ -379,14 +537,21 @@ func (p *Package) Build() error {
 	return nil
 }
 
-// Package drives the FPM instance created during Setup to package the output of
-// the Build step.
+// Package creates an FPM instance to package the output of the Build step.
+// Targets are rendered and staged at this point, since they may refer to
+// files the build created.
 func (p *Package) Package() error {
 	if p.Type == "" {
 		p.logger.Warn("type not set, skipping packaging")
 		return nil
 	}
 
+	fpm, err := NewFPM(p)
+	if err != nil {
+		return err
+	}
+	p.fpm = fpm
+
 	out, err := p.fpm.PackageFor(p.Type)
 	if err != nil {
 		p.logger.WithFields(logrus.Fields{
@@ -397,7 +562,88 @@ func (p *Package) Package() error {
 		return err
 	}
 
-	return nil
+	artifacts, err := p.moveArtifacts()
+	if err != nil {
+		return err
+	}
+	p.Artifacts = artifacts
+
+	return p.WriteManifest()
+}
+
+// moveArtifacts moves everything FPM wrote to StagingRoot into OutputRoot and
+// returns the new locations.
+func (p *Package) moveArtifacts() ([]Artifact, error) {
+	artifacts := []Artifact{}
+
+	files, err := ioutil.ReadDir(p.StagingRoot)
+	if err != nil {
+		p.logger.WithError(err).Error("could not list packages")
+		return artifacts, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		src := path.Join(p.StagingRoot, file.Name())
+		dest := path.Join(p.OutputRoot, file.Name())
+		err := moveFile(src, dest)
+		if err != nil {
+			p.logger.WithFields(logrus.Fields{
+				"error": err,
+				"name":  file.Name(),
+			}).Error("could not move package to output directory")
+			return artifacts, err
+		}
+
+		artifact, err := NewArtifact(dest)
+		if err != nil {
+			p.logger.WithFields(logrus.Fields{
+				"error": err,
+				"name":  file.Name(),
+			}).Error("could not checksum package")
+			return artifacts, err
+		}
+
+		p.logger.WithFields(logrus.Fields{
+			"path":   artifact.Path,
+			"sha256": artifact.SHA256,
+		}).Info("wrote package")
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, nil
+}
+
+// moveFile renames src to dest, falling back to a copy when they are on
+// different filesystems
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(src, dest, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// logName is the name used for build log files. Matrix children share a name
+// with each other, so their matrix values are added to tell them apart.
+func (p *Package) logName() string {
+	if len(p.Matrix) == 0 {
+		return p.Name
+	}
+	return p.Name + "-" + combinationName(p.Matrix)
 }
 
 // TotalPackages is the total count of packages for this and all children.
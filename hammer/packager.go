@@ -25,6 +25,26 @@ func (p *Packager) EnsureOutputDir(path string) error { // TODO: move the callin
 	return nil
 }
 
+// Artifacts returns the artifacts produced by all packages (and their
+// children) in the Packager. It should be called after Build.
+func (p *Packager) Artifacts() []Artifact {
+	artifacts := []Artifact{}
+
+	var collect func(*Package)
+	collect = func(pkg *Package) {
+		artifacts = append(artifacts, pkg.Artifacts...)
+		for _, child := range pkg.Children {
+			collect(child)
+		}
+	}
+
+	for _, pkg := range p.packages {
+		collect(pkg)
+	}
+
+	return artifacts
+}
+
 type workerContext struct {
 	packages chan *Package
 	errors   chan error
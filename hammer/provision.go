@@ -0,0 +1,216 @@
+package hammer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// User is a system user that is created before the package is installed
+type User struct {
+	Name    string `yaml:"name"`
+	Group   string `yaml:"group,omitempty"`
+	Home    string `yaml:"home,omitempty"`
+	Shell   string `yaml:"shell,omitempty"`
+	Comment string `yaml:"comment,omitempty"`
+}
+
+// Group is a system group that is created before the package is installed
+type Group struct {
+	Name string `yaml:"name"`
+}
+
+// Directory is created (if missing) before the package is installed, and
+// given the specified mode and owners. Directories are not removed along with
+// the package, since they usually hold data.
+type Directory struct {
+	Path  string `yaml:"path"`
+	Mode  string `yaml:"mode,omitempty"`
+	User  string `yaml:"user,omitempty"`
+	Group string `yaml:"group,omitempty"`
+}
+
+// Service is a systemd unit. If Unit is set, the unit file is installed as a
+// target. The service is enabled and started after installation if requested,
+// restarted on upgrade, and stopped and disabled on removal.
+type Service struct {
+	Name   string `yaml:"name"`
+	Unit   string `yaml:"unit,omitempty"`
+	Enable bool   `yaml:"enable,omitempty"`
+	Start  bool   `yaml:"start,omitempty"`
+}
+
+// unitName is the full name of the systemd unit, with a ".service" suffix if
+// no other unit type was given
+func (s Service) unitName() string {
+	if strings.Contains(s.Name, ".") {
+		return s.Name
+	}
+	return s.Name + ".service"
+}
+
+// unitDir is where systemd units are installed for the package type
+func (p *Package) unitDir() string {
+	if p.Type == "deb" {
+		return "/lib/systemd/system/"
+	}
+	return "/usr/lib/systemd/system/"
+}
+
+// serviceTargets are the targets that install unit files for Services
+func (p *Package) serviceTargets() []Target {
+	targets := []Target{}
+	for _, service := range p.Services {
+		if service.Unit == "" {
+			continue
+		}
+
+		targets = append(targets, Target{
+			Src:  service.Unit,
+			Dest: path.Join(p.unitDir(), service.unitName()),
+			Mode: "644",
+		})
+	}
+	return targets
+}
+
+// allTargets returns Targets along with any targets generated from the rest
+// of the spec
+func (p *Package) allTargets() []Target {
+	return append(append([]Target{}, p.Targets...), p.serviceTargets()...)
+}
+
+// provisionScripts generates install scripts for Users, Groups, Directories
+// and Services. The scripts are idempotent, and written so that they work as
+// both RPM scriptlets (where $1 is a count of installed versions) and Debian
+// maintainer scripts (where $1 is an action name.)
+func (p *Package) provisionScripts() Scripts {
+	scripts := Scripts{}
+
+	// users, groups and directories are needed before any files land on disk
+	lines := []string{}
+	for _, group := range p.Groups {
+		name := shellQuote(group.Name)
+		lines = append(lines, fmt.Sprintf("getent group %s >/dev/null || groupadd -r %s", name, name))
+	}
+
+	for _, user := range p.Users {
+		name := shellQuote(user.Name)
+
+		args := []string{"-r"}
+		if user.Group != "" {
+			args = append(args, "-g", shellQuote(user.Group))
+		}
+		if user.Home != "" {
+			args = append(args, "-d", shellQuote(user.Home))
+		}
+		shell := user.Shell
+		if shell == "" {
+			shell = "/sbin/nologin"
+		}
+		args = append(args, "-s", shellQuote(shell))
+		if user.Comment != "" {
+			args = append(args, "-c", shellQuote(user.Comment))
+		}
+
+		lines = append(lines, fmt.Sprintf("getent passwd %s >/dev/null || useradd %s %s", name, strings.Join(args, " "), name))
+	}
+
+	for _, dir := range p.Directories {
+		name := shellQuote(dir.Path)
+		lines = append(lines, fmt.Sprintf("mkdir -p %s", name))
+
+		owner := dir.User
+		if dir.Group != "" {
+			owner += ":" + dir.Group
+		}
+		if owner != "" {
+			lines = append(lines, fmt.Sprintf("chown %s %s", shellQuote(owner), name))
+		}
+		if dir.Mode != "" {
+			lines = append(lines, fmt.Sprintf("chmod %s %s", shellQuote(dir.Mode), name))
+		}
+	}
+	scripts.Append("before-install", strings.Join(lines, "\n"))
+
+	if len(p.Services) == 0 {
+		return scripts
+	}
+
+	// services
+	units := []string{}
+	enable := []string{}
+	start := []string{}
+	for _, service := range p.Services {
+		unit := shellQuote(service.unitName())
+		units = append(units, unit)
+		if service.Enable {
+			enable = append(enable, unit)
+		}
+		if service.Start {
+			start = append(start, unit)
+		}
+	}
+
+	// rpm passes 1 on install, deb passes "configure" with no previous version
+	install := `[ "$1" = 1 ] || { [ "$1" = configure ] && [ -z "$2" ]; }`
+	// rpm passes 0 on removal (but 1 on upgrade), deb passes "remove"
+	remove := `[ "$1" = 0 ] || [ "$1" = remove ]`
+
+	after := []string{
+		"if command -v systemctl >/dev/null 2>&1; then",
+		"  systemctl daemon-reload >/dev/null 2>&1 || :",
+	}
+	if len(enable) > 0 {
+		after = append(after, fmt.Sprintf("  systemctl enable %s >/dev/null 2>&1 || :", strings.Join(enable, " ")))
+	}
+	if len(start) > 0 {
+		after = append(after,
+			"  if "+install+"; then",
+			fmt.Sprintf("    systemctl start %s >/dev/null 2>&1 || :", strings.Join(start, " ")),
+			"  else",
+			fmt.Sprintf("    systemctl try-restart %s >/dev/null 2>&1 || :", strings.Join(start, " ")),
+			"  fi",
+		)
+	}
+	after = append(after, "fi")
+	scripts.Append("after-install", strings.Join(after, "\n"))
+
+	scripts.Append("before-remove", strings.Join([]string{
+		"if " + remove + "; then",
+		"  if command -v systemctl >/dev/null 2>&1; then",
+		fmt.Sprintf("    systemctl --no-reload disable %s >/dev/null 2>&1 || :", strings.Join(units, " ")),
+		fmt.Sprintf("    systemctl stop %s >/dev/null 2>&1 || :", strings.Join(units, " ")),
+		"  fi",
+		"fi",
+	}, "\n"))
+
+	scripts.Append("after-remove", strings.Join([]string{
+		"if command -v systemctl >/dev/null 2>&1; then",
+		"  systemctl daemon-reload >/dev/null 2>&1 || :",
+		"fi",
+	}, "\n"))
+
+	return scripts
+}
+
+// allScripts returns the user-provided Scripts merged with the generated
+// provisioning scripts. Generated setup runs before the user's install and
+// remove scripts, and services are started after the user's install script.
+func (p *Package) allScripts() Scripts {
+	scripts := Scripts{}
+	for name, script := range p.Scripts {
+		scripts[name] = script
+	}
+
+	for name, generated := range p.provisionScripts() {
+		switch name {
+		case "before-install", "before-remove":
+			scripts.Prepend(name, generated)
+		default:
+			scripts.Append(name, generated)
+		}
+	}
+
+	return scripts
+}
@@ -0,0 +1,133 @@
+package hammer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionScripts(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected Scripts
+	}{
+		{
+			"nothing declared",
+			"name: foo\n",
+			Scripts{},
+		},
+		{
+			"users, groups and directories",
+			`name: consul
+groups:
+- name: consul
+users:
+- name: consul
+  group: consul
+  home: /var/lib/consul
+  comment: "Consul's user"
+directories:
+- path: /var/lib/consul
+  user: consul
+  group: consul
+  mode: 750
+`,
+			Scripts{"before-install": strings.Join([]string{
+				"getent group 'consul' >/dev/null || groupadd -r 'consul'",
+				`getent passwd 'consul' >/dev/null || useradd -r -g 'consul' -d '/var/lib/consul' -s '/sbin/nologin' -c 'Consul'\''s user' 'consul'`,
+				"mkdir -p '/var/lib/consul'",
+				"chown 'consul:consul' '/var/lib/consul'",
+				"chmod '750' '/var/lib/consul'",
+			}, "\n") + "\n"},
+		},
+		{
+			"services",
+			`name: consul
+services:
+- name: consul
+  enable: true
+  start: true
+- name: consul-backup.timer
+`,
+			Scripts{
+				"after-install": strings.Join([]string{
+					"if command -v systemctl >/dev/null 2>&1; then",
+					"  systemctl daemon-reload >/dev/null 2>&1 || :",
+					"  systemctl enable 'consul.service' >/dev/null 2>&1 || :",
+					`  if [ "$1" = 1 ] || { [ "$1" = configure ] && [ -z "$2" ]; }; then`,
+					"    systemctl start 'consul.service' >/dev/null 2>&1 || :",
+					"  else",
+					"    systemctl try-restart 'consul.service' >/dev/null 2>&1 || :",
+					"  fi",
+					"fi",
+				}, "\n") + "\n",
+				"before-remove": strings.Join([]string{
+					`if [ "$1" = 0 ] || [ "$1" = remove ]; then`,
+					"  if command -v systemctl >/dev/null 2>&1; then",
+					"    systemctl --no-reload disable 'consul.service' 'consul-backup.timer' >/dev/null 2>&1 || :",
+					"    systemctl stop 'consul.service' 'consul-backup.timer' >/dev/null 2>&1 || :",
+					"  fi",
+					"fi",
+				}, "\n") + "\n",
+				"after-remove": strings.Join([]string{
+					"if command -v systemctl >/dev/null 2>&1; then",
+					"  systemctl daemon-reload >/dev/null 2>&1 || :",
+					"fi",
+				}, "\n") + "\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := NewPackageFromYAML([]byte(test.spec))
+		if assert.NoError(t, err, test.name) {
+			assert.Equal(t, test.expected, p.provisionScripts(), test.name)
+		}
+	}
+}
+
+func TestAllScripts(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`name: consul
+groups:
+- name: consul
+services:
+- name: consul
+scripts:
+  before-install: echo mine
+  after-install: echo mine
+`))
+	assert.NoError(t, err)
+
+	scripts := p.allScripts()
+
+	// setup runs before the user's scripts, services after
+	assert.True(t, strings.HasPrefix(scripts["before-install"], "getent group"))
+	assert.True(t, strings.HasSuffix(scripts["before-install"], "\n\necho mine\n"))
+	assert.True(t, strings.HasPrefix(scripts["after-install"], "echo mine\n\n"))
+
+	// the spec's own scripts are left alone
+	assert.Equal(t, "echo mine", p.Scripts["before-install"])
+}
+
+func TestServiceTargets(t *testing.T) {
+	tests := []struct {
+		typ, dest string
+	}{
+		{"rpm", "/usr/lib/systemd/system/consul.service"},
+		{"deb", "/lib/systemd/system/consul.service"},
+	}
+
+	for _, test := range tests {
+		p := NewPackage()
+		p.Type = test.typ
+		p.Targets = []Target{{Src: "consul", Dest: "/usr/bin/"}}
+		p.Services = []Service{{Name: "consul", Unit: "consul.service"}, {Name: "no-unit"}}
+
+		assert.Equal(t, []Target{
+			{Src: "consul", Dest: "/usr/bin/"},
+			{Src: "consul.service", Dest: test.dest, Mode: "644"},
+		}, p.allTargets(), test.typ)
+	}
+}
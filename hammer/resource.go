@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path"
+	"sort"
+	"strings"
 )
 
 var (
@@ -27,19 +29,37 @@ var (
 	ErrBadHashType = errors.New("bad hash type")
 )
 
+// Hashers are the hash types Hammer can check resources with
+var Hashers = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+}
+
+// HashTypes returns the names of the Hashers, in order
+func HashTypes() []string {
+	types := []string{}
+	for name := range Hashers {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
 // Resource describes a remote resource that will be downloaded to be built for
 // the package.
 type Resource struct {
 	URL      string `yaml:"url"`
 	HashType string `yaml:"hash-type"`
 	Hash     string `yaml:"hash"`
-	Unpack   bool   `yaml:"unpack"`
+	Unpack   bool   `yaml:"unpack,omitempty"`
 }
 
 // RenderURL renders the resource URL with the given package. If it fails, it
 // just uses the raw name (useful if the URL contains odd characters)
 func (s *Resource) RenderURL(p *Package) string {
-	url, err := p.template.Render(s.URL)
+	url, err := p.template.RenderField("resources.url", s.URL)
 
 	var out string
 	if err != nil {
@@ -93,7 +113,10 @@ func (s *Resource) Download(p *Package) ([]byte, error) {
 	// checksum
 	sum, err := s.sum(body)
 	if err == ErrBadHashType {
-		logger.WithField("type", s.HashType).Error("bad hash type (try md5 or sha1)")
+		logger.WithFields(logrus.Fields{
+			"type":  s.HashType,
+			"known": strings.Join(HashTypes(), ", "),
+		}).Error("bad hash type")
 		return nil, err
 	} else if err != nil {
 		logger.WithField("error", err).Error("could not sum resource")
@@ -111,20 +134,11 @@ func (s *Resource) Download(p *Package) ([]byte, error) {
 }
 
 func (s *Resource) sum(body []byte) (string, error) {
-	var hasher hash.Hash
-
-	switch s.HashType {
-	case "md5":
-		hasher = md5.New()
-	case "sha1":
-		hasher = sha1.New()
-	case "sha256":
-		hasher = sha256.New()
-	case "sha224":
-		hasher = sha256.New224()
-	default:
+	newHasher, ok := Hashers[s.HashType]
+	if !ok {
 		return "", ErrBadHashType
 	}
+	hasher := newHasher()
 
 	_, err := hasher.Write(body)
 	if err != nil {
@@ -0,0 +1,311 @@
+package hammer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaVersion is the JSON Schema draft that Schema follows
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+var varsType = reflect.TypeOf(Vars{})
+
+// schemaRequired lists the fields that must be set in each item of a list,
+// by type. Package fields aren't required by the schema, since they can come
+// from a parent, a base spec or the project defaults. Required fields are
+// only checked by Lint, once a package is loaded.
+var schemaRequired = map[string][]string{
+	"Resource":   {"url", "hash-type", "hash"},
+	"Target":     {"dest"},
+	"Attr":       {"file"},
+	"User":       {"name"},
+	"Group":      {"name"},
+	"Directory":  {"path"},
+	"Service":    {"name"},
+	"Subpackage": {"suffix"},
+}
+
+// schemaEnums lists the values allowed for string fields, by type and field
+func schemaEnums() map[string][]string {
+	return map[string][]string{
+		"Resource.HashType": HashTypes(),
+		"Target.Type":       {TargetFile, TargetDir, TargetSymlink},
+		"Package.Merge":     {MergeReplace, MergeAppend, MergeDeep},
+	}
+}
+
+// Schema returns a JSON Schema for specs, generated from Package and the
+// types inside it. Scripts are limited to ScriptNames and hash types to
+// Hashers.
+func Schema() map[string]interface{} {
+	g := &schemaGenerator{
+		definitions: map[string]interface{}{},
+		enums:       schemaEnums(),
+	}
+	root := g.schema(reflect.TypeOf(Package{}), nil)
+
+	return map[string]interface{}{
+		"$schema":     SchemaVersion,
+		"title":       "Hammer package spec",
+		"$ref":        root["$ref"],
+		"definitions": g.definitions,
+	}
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+	enums       map[string][]string
+}
+
+// schema returns the schema for a type. Structs are added to the definitions
+// and referred to.
+func (g *schemaGenerator) schema(t reflect.Type, enum []string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == scriptsType:
+		properties := map[string]interface{}{}
+		for _, name := range ScriptNames {
+			properties[name] = g.schema(reflect.TypeOf(""), nil)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+
+	case t == varsType:
+		return map[string]interface{}{"type": "object"}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": g.schema(t.Elem(), enum),
+		}
+
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.schema(t.Elem(), enum),
+		}
+
+	case reflect.String:
+		if enum != nil {
+			return map[string]interface{}{"type": "string", "enum": enum}
+		}
+		// YAML reads numbers into strings too, like "mode: 755"
+		return map[string]interface{}{"type": []string{"string", "number"}}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	}
+
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	name := []rune(t.Name())
+	name[0] = unicode.ToLower(name[0])
+	ref := map[string]interface{}{"$ref": "#/definitions/" + string(name)}
+
+	if _, ok := g.definitions[string(name)]; ok {
+		return ref
+	}
+
+	properties := map[string]interface{}{}
+	definition := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t.Name()]; ok {
+		definition["required"] = required
+	}
+	// added before the fields, for types that contain themselves
+	g.definitions[string(name)] = definition
+
+	for _, field := range yamlFields(t) {
+		structField := t.Field(field.Index)
+		enum := g.enums[t.Name()+"."+structField.Name]
+
+		if strings.Contains(structField.Tag.Get("yaml"), ",inline") {
+			definition["additionalProperties"] = g.schema(structField.Type.Elem(), enum)
+			continue
+		}
+		properties[field.Name] = g.schema(structField.Type, enum)
+	}
+
+	return ref
+}
+
+// ValidateSpec checks the content of a single spec file against Schema: the
+// types and allowed values of fields, and unknown fields. Fields the schema
+// requires are not checked, since they may be set in another file that the
+// spec is merged with. Lint checks those.
+func ValidateSpec(content []byte) ([]Problem, error) {
+	var doc interface{}
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return validateSchema(normalizeValue(doc), false), nil
+}
+
+// validateSchema checks a document against Schema, with or without the fields
+// it requires
+func validateSchema(doc interface{}, required bool) []Problem {
+	schema := Schema()
+	v := &schemaValidator{
+		definitions: schema["definitions"].(map[string]interface{}),
+		required:    required,
+		problems:    []Problem{},
+	}
+	v.validate(doc, schema, "")
+
+	return v.problems
+}
+
+// schemaValidator checks values against the subset of JSON Schema that Schema
+// uses
+type schemaValidator struct {
+	definitions map[string]interface{}
+	required    bool
+	problems    []Problem
+}
+
+func (v *schemaValidator) add(field, format string, args ...interface{}) {
+	if field == "" {
+		field = "spec"
+	}
+	v.problems = append(v.problems, Problem{field, fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) validate(value interface{}, schema map[string]interface{}, field string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = v.definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+
+	// empty values are the same as leaving the field out
+	if value == nil || value == "" {
+		return
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		ok := false
+		for _, t := range types {
+			ok = ok || t == actual || t == "number" && actual == "integer"
+		}
+		if !ok {
+			v.add(field, "should be %s, not %s", strings.Join(types, " or "), actual)
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]string); ok {
+		s := fmt.Sprint(value)
+		found := false
+		for _, allowed := range enum {
+			found = found || s == allowed
+		}
+		if !found {
+			v.add(field, "%q is not one of %s", s, strings.Join(enum, ", "))
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(typed, schema, field)
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range typed {
+				v.validate(item, items, fmt.Sprintf("%s[%d]", field, i))
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(object map[string]interface{}, schema map[string]interface{}, field string) {
+	prefix := field
+	if prefix != "" {
+		prefix += "."
+	}
+
+	if required, ok := schema["required"].([]string); ok && v.required {
+		for _, name := range required {
+			if object[name] == nil || object[name] == "" {
+				v.add(prefix+name, "is required")
+			}
+		}
+	}
+
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, key := range keys {
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			v.validate(object[key], property, prefix+key)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.add(prefix+key, "is not a known field")
+			}
+		case map[string]interface{}:
+			v.validate(object[key], additional, prefix+key)
+		}
+	}
+}
+
+// schemaTypes reads the "type" of a schema, which is a name or a list
+func schemaTypes(t interface{}) []string {
+	switch typed := t.(type) {
+	case string:
+		return []string{typed}
+	case []string:
+		return typed
+	}
+	return nil
+}
+
+// jsonType names the JSON type of a value read from YAML
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
@@ -0,0 +1,50 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSpec(t *testing.T) {
+	problems, err := ValidateSpec([]byte(`name: foo
+iteration: 1
+extras: true
+resources:
+- url: http://example.com/foo.tgz
+  hash-type: crc32
+targets:
+- src: foo
+  dest: /usr/bin/
+  mode: 755
+- type: dir
+upstream:
+  github: [foo, bar]
+scripts:
+  build: make
+  after-instal: echo typo
+`))
+	assert.NoError(t, err)
+
+	// required fields are left to Lint, since they can be set elsewhere
+	assert.Equal(t, []Problem{
+		{"extras", "is not a known field"},
+		{"resources[0].hash-type", `"crc32" is not one of md5, sha1, sha224, sha256`},
+		{"scripts.after-instal", "is not a known field"},
+		{"upstream.github", "should be string or number, not array"},
+	}, problems)
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	assert.Equal(t, "#/definitions/package", schema["$ref"])
+
+	definitions := schema["definitions"].(map[string]interface{})
+	for _, name := range []string{"package", "resource", "target", "attr", "matrix"} {
+		assert.Contains(t, definitions, name)
+	}
+
+	resource := definitions["resource"].(map[string]interface{})
+	hashType := resource["properties"].(map[string]interface{})["hash-type"].(map[string]interface{})
+	assert.Equal(t, HashTypes(), hashType["enum"])
+}
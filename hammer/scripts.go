@@ -6,6 +6,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"io/ioutil"
 	"path"
+	"strings"
 )
 
 var (
@@ -13,6 +14,15 @@ var (
 	ErrNoScript = errors.New("no such script")
 )
 
+// ScriptNames are the scripts Hammer knows what to do with: "build" is run
+// during the build, and the rest are passed to FPM.
+var ScriptNames = []string{
+	"build",
+	"before-install", "after-install",
+	"before-remove", "after-remove",
+	"before-upgrade", "after-upgrade",
+}
+
 // Scripts is just an alias for a map[string]string - this means that you can
 // specify any script names you like (whether they'll be accepted, however, is a
 // different story)
@@ -26,7 +36,7 @@ func (s Scripts) Content(p *Package, name string) (bytes.Buffer, error) {
 		return bytes.Buffer{}, ErrNoScript
 	}
 
-	out, err := p.template.Render(source)
+	out, err := p.template.RenderField("scripts."+name, source)
 	if err != nil {
 		p.logger.WithFields(logrus.Fields{
 			"name":  name,
@@ -65,3 +75,29 @@ func (s Scripts) RenderAndWriteAll(p *Package) (map[string]string, error) {
 
 	return locations, nil
 }
+
+// Append adds content to the end of the named script, creating it if it does
+// not exist yet. Empty content is ignored.
+func (s Scripts) Append(name, content string) {
+	if content == "" {
+		return
+	}
+
+	if existing, ok := s[name]; ok && existing != "" {
+		content = strings.TrimRight(existing, "\n") + "\n\n" + content
+	}
+	s[name] = strings.TrimRight(content, "\n") + "\n"
+}
+
+// Prepend adds content to the start of the named script, creating it if it
+// does not exist yet. Empty content is ignored.
+func (s Scripts) Prepend(name, content string) {
+	if content == "" {
+		return
+	}
+
+	if existing, ok := s[name]; ok && existing != "" {
+		content = strings.TrimRight(content, "\n") + "\n\n" + existing
+	}
+	s[name] = strings.TrimRight(content, "\n") + "\n"
+}
@@ -0,0 +1,401 @@
+package hammer
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	// ErrUnknownSkeleton is returned when a skeleton is neither built in nor
+	// in the skeleton directory.
+	ErrUnknownSkeleton = errors.New("no such skeleton")
+
+	// ErrSpecExists is returned when generating a spec into a directory that
+	// already has one.
+	ErrSpecExists = errors.New("spec already exists")
+
+	// ErrNoSource is returned when a skeleton's resource has no URL, because
+	// neither Source nor (for skeletons that can use it) GitHub is set.
+	ErrNoSource = errors.New("skeleton needs a source URL for its resource")
+)
+
+// SkeletonFields are the values available to skeletons. Skeletons are Go
+// templates using "[[" and "]]" as delimiters, so that they can contain
+// regular spec templates.
+type SkeletonFields struct {
+	Name        string
+	Version     string
+	Type        string
+	Description string
+	License     string
+	Vendor      string
+	URL         string
+	GitHub      string // "owner/repo", for GitHub releases and upstream checks
+	Source      string // URL of the resource
+	HashType    string
+	Hash        string
+}
+
+// Skeletons are the built-in skeletons for new specs, by name. Each maps file
+// names to their content, and both are rendered.
+var Skeletons = map[string]map[string]string{
+	"go-binary": {"spec.yml": goBinarySkeleton},
+	"autotools": {"spec.yml": autotoolsSkeleton},
+	"python":    {"spec.yml": pythonSkeleton},
+	"config": {
+		"spec.yml":       configSkeleton,
+		"[[.Name]].conf": configFileSkeleton,
+	},
+}
+
+const goBinarySkeleton = `[[- $source := or .Source (and .GitHub (printf "https://github.com/%s/releases/download/v{{.Version}}/%s_{{.Version}}_linux_amd64.tar.gz" .GitHub .Name)) -]]
+name: [[.Name]]
+version: [[.Version]]
+iteration: 1
+type: [[.Type]]
+[[- if .License]]
+license: [[.License]][[end]]
+[[- if .Vendor]]
+vendor: [[.Vendor]][[end]]
+[[- if .URL]]
+url: [[.URL]][[end]]
+description: [[quote .Description]]
+[[- if .GitHub]]
+
+upstream:
+  github: [[.GitHub]]
+[[- end]]
+
+resources:
+- url: [[$source]]
+  hash-type: [[.HashType]]
+  hash: [[.Hash]]
+
+targets:
+- src: "{{.BuildRoot}}/[[.Name]]"
+  dest: /usr/bin/
+  mode: 755
+
+scripts:
+  build: |
+    tar -xzf [[base $source]]
+`
+
+const autotoolsSkeleton = `name: [[.Name]]
+version: [[.Version]]
+iteration: 1
+type: [[.Type]]
+[[- if .License]]
+license: [[.License]][[end]]
+[[- if .Vendor]]
+vendor: [[.Vendor]][[end]]
+[[- if .URL]]
+url: [[.URL]][[end]]
+description: [[quote .Description]]
+
+resources:
+- url: [[.Source]]
+  hash-type: [[.HashType]]
+  hash: [[.Hash]]
+
+targets:
+- src: "{{.BuildRoot}}/install/usr/"
+  dest: /usr/
+
+scripts:
+  build: |
+    tar -xzf [[base .Source]] --strip-components=1
+    ./configure --prefix=/usr
+    make -j{{.CPUs}}
+    make install DESTDIR={{.BuildRoot}}/install
+`
+
+const pythonSkeleton = `name: [[.Name]]
+version: [[.Version]]
+iteration: 1
+type: [[.Type]]
+[[- if .License]]
+license: [[.License]][[end]]
+[[- if .Vendor]]
+vendor: [[.Vendor]][[end]]
+[[- if .URL]]
+url: [[.URL]][[end]]
+description: [[quote .Description]]
+
+depends:
+- python3
+
+resources:
+- url: [[.Source]]
+  hash-type: [[.HashType]]
+  hash: [[.Hash]]
+
+# the virtualenv is installed as a whole into /opt/[[.Name]]
+targets:
+- src: "{{.BuildRoot}}/venv/"
+  dest: /opt/[[.Name]]/
+- src: /opt/[[.Name]]/bin/[[.Name]]
+  dest: /usr/bin/[[.Name]]
+  type: symlink
+
+scripts:
+  build: |
+    mkdir src
+    tar -xzf [[base .Source]] -C src --strip-components=1
+    python3 -m venv --copies venv
+    venv/bin/pip install ./src
+`
+
+const configSkeleton = `name: [[.Name]]
+version: [[.Version]]
+iteration: 1
+type: [[.Type]]
+architecture: noarch
+[[- if .License]]
+license: [[.License]][[end]]
+[[- if .Vendor]]
+vendor: [[.Vendor]][[end]]
+[[- if .URL]]
+url: [[.URL]][[end]]
+description: [[quote .Description]]
+
+targets:
+- src: "{{.SpecRoot}}/[[.Name]].conf"
+  dest: /etc/[[.Name]]/
+  config: true
+  template: true
+`
+
+const configFileSkeleton = `# [[.Name]] configuration, packaged by Hammer as version {{.Version}}
+`
+
+// Scaffold generates a new spec directory from a skeleton
+type Scaffold struct {
+	Skeleton string
+	Fields   SkeletonFields
+
+	// SkeletonDir holds user skeletons, each a directory of files named after
+	// the skeleton. They take precedence over the built-in ones.
+	SkeletonDir string
+
+	// Fetch downloads the first resource, if the spec has one, to fill in its
+	// hash.
+	Fetch  bool
+	Client *http.Client
+}
+
+// NewScaffold returns a Scaffold for the named skeleton, with default fields
+func NewScaffold(skeleton string) *Scaffold {
+	return &Scaffold{
+		Skeleton: skeleton,
+		Fields: SkeletonFields{
+			Version:  "0.1.0",
+			Type:     "rpm",
+			HashType: "sha256",
+		},
+		Fetch:  true,
+		Client: &http.Client{},
+	}
+}
+
+// SkeletonNames lists the built-in skeletons and those in dir
+func SkeletonNames(dir string) []string {
+	names := []string{}
+	for name := range Skeletons {
+		names = append(names, name)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() && Skeletons[entry.Name()] == nil {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Generate writes the rendered skeleton to dir and returns the path of the
+// spec.
+func (s *Scaffold) Generate(dir string) (string, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"skeleton": s.Skeleton,
+		"name":     s.Fields.Name,
+	})
+	specPath := filepath.Join(dir, "spec.yml")
+
+	for _, name := range SpecNames {
+		existing := filepath.Join(dir, name)
+		if _, err := os.Stat(existing); err == nil {
+			logger.WithField("path", existing).Error(ErrSpecExists)
+			return existing, ErrSpecExists
+		}
+	}
+
+	files, err := s.files()
+	if err != nil {
+		logger.WithError(err).Error("could not read skeleton")
+		return specPath, err
+	}
+
+	rendered, err := s.render(files)
+	if err != nil {
+		logger.WithError(err).Error("could not render skeleton")
+		return specPath, err
+	}
+
+	if missingSource(rendered["spec.yml"]) {
+		logger.Error(ErrNoSource)
+		return specPath, ErrNoSource
+	}
+
+	if s.Fetch && s.Fields.Hash == "" {
+		hash, err := s.hash(rendered["spec.yml"])
+		if err != nil {
+			logger.WithError(err).Error("could not compute resource hash")
+			return specPath, err
+		}
+
+		if hash != "" {
+			s.Fields.Hash = hash
+			rendered, err = s.render(files)
+			if err != nil {
+				logger.WithError(err).Error("could not render skeleton")
+				return specPath, err
+			}
+		}
+	}
+
+	for name, content := range rendered {
+		dest := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			logger.WithError(err).Error("could not create directory")
+			return specPath, err
+		}
+
+		err = ioutil.WriteFile(dest, content, 0644)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"path":  dest,
+			}).Error("could not write file")
+			return specPath, err
+		}
+		logger.WithField("path", dest).Debug("wrote file")
+	}
+
+	return specPath, nil
+}
+
+// files returns the unrendered files of the skeleton, from SkeletonDir or the
+// built-in skeletons
+func (s *Scaffold) files() (map[string]string, error) {
+	root := filepath.Join(s.SkeletonDir, s.Skeleton)
+	if info, err := os.Stat(root); s.SkeletonDir != "" && err == nil && info.IsDir() {
+		files := map[string]string{}
+		err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			content, err := ioutil.ReadFile(name)
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			files[rel] = string(content)
+			return nil
+		})
+		return files, err
+	}
+
+	files, ok := Skeletons[s.Skeleton]
+	if !ok {
+		return nil, ErrUnknownSkeleton
+	}
+	return files, nil
+}
+
+// render renders the names and contents of files with the fields
+func (s *Scaffold) render(files map[string]string) (map[string][]byte, error) {
+	funcs := template.FuncMap{
+		"base":  path.Base,
+		"quote": strconv.Quote,
+	}
+
+	rendered := map[string][]byte{}
+	for name, content := range files {
+		for _, part := range []*string{&name, &content} {
+			tmpl, err := template.New(name).Delims("[[", "]]").Funcs(funcs).Parse(*part)
+			if err != nil {
+				return nil, err
+			}
+
+			var buf bytes.Buffer
+			err = tmpl.Execute(&buf, s.Fields)
+			if err != nil {
+				return nil, err
+			}
+			*part = buf.String()
+		}
+
+		rendered[name] = []byte(content)
+	}
+
+	return rendered, nil
+}
+
+// missingSource checks whether any resource in the spec was left without a
+// URL
+func missingSource(spec []byte) bool {
+	p, err := NewPackageFromYAML(spec)
+	if err != nil {
+		return false
+	}
+
+	for _, resource := range p.Resources {
+		if resource.URL == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hash downloads the first resource of the spec, if it has one with a URL,
+// and returns its hash
+func (s *Scaffold) hash(spec []byte) (string, error) {
+	p, err := NewPackageFromYAML(spec)
+	if err != nil {
+		return "", err
+	}
+
+	if len(p.Resources) == 0 || p.Resources[0].URL == "" {
+		return "", nil
+	}
+	resource := p.Resources[0]
+
+	url := resource.RenderURL(p)
+	p.logger.WithField("url", url).Info("downloading resource to compute hash")
+	body, err := fetch(s.Client, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return resource.sum(body)
+}
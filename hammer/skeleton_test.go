@@ -0,0 +1,170 @@
+package hammer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaffoldGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foo_1.2.0_linux_amd64.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "release")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hammer-scaffold")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, skeleton := range SkeletonNames("") {
+		scaffold := NewScaffold(skeleton)
+		scaffold.Fields.Name = "foo"
+		scaffold.Fields.Version = "1.2.0"
+		scaffold.Fields.Description = "foo: a tool"
+		scaffold.Fields.Source = server.URL + "/foo_{{.Version}}_linux_amd64.tar.gz"
+
+		spec, err := scaffold.Generate(filepath.Join(dir, skeleton))
+		if !assert.NoError(t, err, skeleton) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(spec)
+		assert.NoError(t, err)
+		p, err := NewPackageFromYAML(content)
+		if !assert.NoError(t, err, skeleton) {
+			continue
+		}
+
+		assert.Equal(t, "foo: a tool", p.Description)
+		assert.Empty(t, p.Lint(), skeleton)
+
+		if len(p.Resources) > 0 {
+			sum := sha256.Sum256([]byte("release"))
+			assert.Equal(t, hex.EncodeToString(sum[:]), p.Resources[0].Hash, skeleton)
+		}
+	}
+
+	_, err = NewScaffold("go-binary").Generate(filepath.Join(dir, "go-binary"))
+	assert.Equal(t, ErrSpecExists, err)
+
+	_, err = NewScaffold("nope").Generate(filepath.Join(dir, "nope"))
+	assert.Equal(t, ErrUnknownSkeleton, err)
+}
+
+func TestScaffoldNeedsSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-scaffold")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the defaults, as with a plain `hammer new foo`
+	for _, skeleton := range []string{"go-binary", "autotools", "python"} {
+		scaffold := NewScaffold(skeleton)
+		scaffold.Fields.Name = "foo"
+
+		_, err := scaffold.Generate(filepath.Join(dir, skeleton))
+		assert.Equal(t, ErrNoSource, err, skeleton)
+
+		_, err = os.Stat(filepath.Join(dir, skeleton, "spec.yml"))
+		assert.True(t, os.IsNotExist(err), skeleton)
+	}
+
+	// config files don't need one
+	scaffold := NewScaffold("config")
+	scaffold.Fields.Name = "foo"
+	_, err = scaffold.Generate(filepath.Join(dir, "config"))
+	assert.NoError(t, err)
+
+	// and go-binary can find its release on GitHub
+	scaffold = NewScaffold("go-binary")
+	scaffold.Fields.Name = "foo"
+	scaffold.Fields.GitHub = "example/foo"
+	scaffold.Fetch = false
+	spec, err := scaffold.Generate(filepath.Join(dir, "github"))
+	if assert.NoError(t, err) {
+		content, err := ioutil.ReadFile(spec)
+		assert.NoError(t, err)
+		p, err := NewPackageFromYAML(content)
+		assert.NoError(t, err)
+		if assert.Len(t, p.Resources, 1) {
+			assert.Equal(t, "https://github.com/example/foo/releases/download/v{{.Version}}/foo_{{.Version}}_linux_amd64.tar.gz", p.Resources[0].URL)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`name: foo
+resources:
+- url: http://example.com/foo.tgz
+  hash-type: crc32
+targets:
+- dest: /usr/bin/foo
+- dest: /var/lib/foo
+  type: dir
+scripts:
+  build: make
+  after-instal: echo typo
+`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Problem{
+		{"version", "is required"},
+		{"type", "is required"},
+		{"targets[0].src", "is required"},
+		{"resources[0].hash", "is required"},
+		{"resources[0].hash-type", `"crc32" is not one of md5, sha1, sha224, sha256`},
+		{"scripts.after-instal", "is not a known field"},
+	}, p.Lint())
+}
+
+func TestLintMergedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-lint-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, ConfigName), []byte(`defaults:
+  type: rpm
+  resources:
+  - url: http://example.com/foo.tgz
+`), 0644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "foo"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "foo", "base.yml"), []byte(`targets:
+- src: foo
+`), 0644))
+	spec := `name: foo
+version: 1.0
+extends: base.yml
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "foo", "spec.yml"), []byte(spec), 0644))
+
+	// each file is fine on its own
+	for _, content := range []string{spec, "targets:\n- src: foo\n", "resources:\n- url: http://example.com/foo.tgz\n"} {
+		problems, err := ValidateSpec([]byte(content))
+		assert.NoError(t, err)
+		assert.Empty(t, problems, content)
+	}
+
+	loader := NewLoader(dir)
+	loader.Overrides = []Override{{Key: "scripts", Value: "{build: make, after-instal: echo typo}"}}
+	pkgs, err := loader.Load()
+	assert.NoError(t, err)
+	if assert.Len(t, pkgs, 1) {
+		assert.Equal(t, []Problem{
+			{"resources[0].hash-type", "is required"},
+			{"resources[0].hash", "is required"},
+			{"scripts.after-instal", "is not a known field"},
+			{"targets[0].dest", "is required"},
+		}, pkgs[0].Lint())
+	}
+}
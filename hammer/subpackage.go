@@ -0,0 +1,76 @@
+package hammer
+
+// Subpackage is an extra package made from the output of its parent's build,
+// like "foo-devel" or "foo-doc". It is named after the parent with Suffix
+// added, and shares the parent's version information and metadata but none of
+// its targets, scripts or install-time setup.
+//
+// Unless Standalone is set, a subpackage depends on the exact version of the
+// parent package.
+type Subpackage struct {
+	Suffix      string   `yaml:"suffix"`
+	Description string   `yaml:"description,omitempty"`
+	Targets     []Target `yaml:"targets,omitempty"`
+	Depends     []string `yaml:"depends,omitempty"`
+	Scripts     Scripts  `yaml:"scripts,omitempty"`
+	Standalone  bool     `yaml:"standalone,omitempty"`
+}
+
+// expandSubpackage creates a child package for a Subpackage. The child shares
+// the parent's build.
+func (p *Package) expandSubpackage(sub Subpackage) (*Package, error) {
+	child, err := p.expandSingle(new(Package))
+	if err != nil {
+		return child, err
+	}
+
+	child.Name = p.Name + "-" + sub.Suffix
+	child.SharedBuild = true
+	child.Subpackages = nil
+
+	if sub.Description != "" {
+		child.Description = sub.Description
+	}
+
+	// these are all specific to the main package
+	child.Targets = append([]Target{}, sub.Targets...)
+	child.Attrs = nil
+	child.Obsoletes = nil
+	child.Resources = nil
+	child.Verification = Verification{}
+	child.Users = nil
+	child.Groups = nil
+	child.Directories = nil
+	child.Services = nil
+
+	child.Scripts = Scripts{}
+	for name, script := range sub.Scripts {
+		child.Scripts[name] = script
+	}
+
+	child.Depends = []string{}
+	if !sub.Standalone {
+		child.Depends = append(child.Depends, p.Name+" = "+p.fullVersion())
+	}
+	child.Depends = append(child.Depends, sub.Depends...)
+
+	child.logger = p.logger.WithField("name", child.Name)
+
+	return child, nil
+}
+
+// fullVersion is the unrendered "epoch:version-iteration" of the package, as
+// used in dependencies
+func (p *Package) fullVersion() string {
+	version := p.Version
+	if p.Iteration == IterationAuto {
+		// subpackages share the iteration picked for the main package
+		version += "-{{.Iteration}}"
+	} else if p.Iteration != "" {
+		version += "-" + p.Iteration
+	}
+	if p.Epoch != "" {
+		version = p.Epoch + ":" + version
+	}
+	return version
+}
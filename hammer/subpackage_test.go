@@ -0,0 +1,86 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandSubpackage(t *testing.T) {
+	cases := []struct {
+		name       string
+		spec       string
+		standalone bool
+		depends    []string
+	}{
+		{
+			name:    "depends on the exact version",
+			spec:    "name: foo\nversion: 1.0.0\niteration: 2\nepoch: 1",
+			depends: []string{"foo = 1:1.0.0-2", "libfoo"},
+		},
+		{
+			name:    "shares an automatic iteration",
+			spec:    "name: foo\nversion: 1.0.0\niteration: auto",
+			depends: []string{"foo = 1.0.0-{{.Iteration}}", "libfoo"},
+		},
+		{
+			name:       "standalone",
+			spec:       "name: foo\nversion: 1.0.0",
+			standalone: true,
+			depends:    []string{"libfoo"},
+		},
+	}
+
+	for _, c := range cases {
+		p, err := NewPackageFromYAML([]byte(c.spec + `
+description: Foo
+targets: [{src: foo, dest: /usr/bin/}]
+scripts: {build: make, after-install: ldconfig}
+users: [{name: foo}]
+subpackages:
+- suffix: devel
+  targets: [{src: include/, dest: /usr/include/}]
+  depends: [libfoo]
+`))
+		assert.Nil(t, err, c.name)
+		p.Subpackages[0].Standalone = c.standalone
+		assert.Nil(t, p.ExpandRecursive(nil), c.name)
+
+		if !assert.Len(t, p.Children, 1, c.name) {
+			continue
+		}
+		sub := p.Children[0]
+
+		assert.Equal(t, "foo-devel", sub.Name, c.name)
+		assert.Equal(t, "Foo", sub.Description, c.name)
+		assert.Equal(t, c.depends, sub.Depends, c.name)
+		assert.Equal(t, []Target{{Src: "include/", Dest: "/usr/include/"}}, sub.Targets, c.name)
+		assert.Equal(t, Scripts{}, sub.Scripts, c.name)
+		assert.Empty(t, sub.Users, c.name)
+		assert.True(t, sub.SharedBuild, c.name)
+		assert.Equal(t, p, sub.buildOwner(), c.name)
+	}
+}
+
+func TestSubpackagesInMatrix(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`
+name: foo
+matrix: {arch: [amd64, arm]}
+subpackages: [{suffix: doc}]
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, p.ExpandRecursive(nil))
+
+	// the matrix parent isn't built, so each child gets the subpackages
+	assert.Len(t, p.Children, 2)
+	for _, child := range p.Children {
+		assert.Len(t, child.Children, 1)
+		assert.Equal(t, "foo-doc", child.Children[0].Name)
+		assert.Equal(t, child, child.Children[0].buildOwner())
+	}
+
+	// a subpackage never has a build of its own to share
+	sub := p.Children[0].Children[0]
+	sub.Parent = nil
+	assert.Equal(t, ErrNoSharedBuild, sub.Setup())
+}
@@ -0,0 +1,525 @@
+package hammer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	// ErrBadTargetType is returned when a target's type is not one of "file",
+	// "dir" or "symlink".
+	ErrBadTargetType = errors.New("target type must be one of file, dir or symlink")
+
+	// ErrBadMode is returned when a mode can't be parsed as an octal number.
+	ErrBadMode = errors.New("mode must be an octal number")
+
+	// ErrNoMatches is returned when a target's source does not exist, or its
+	// glob pattern matches no files, and the target is not optional.
+	ErrNoMatches = errors.New("target source matched no files")
+)
+
+// target types
+const (
+	TargetFile    = "file"
+	TargetDir     = "dir"
+	TargetSymlink = "symlink"
+)
+
+// parseMode parses an octal mode string like "0755" or "644"
+func parseMode(raw string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil {
+		return 0, ErrBadMode
+	}
+	return os.FileMode(mode).Perm(), nil
+}
+
+// installedPath returns where a target will end up in the installed package,
+// given its rendered source and destination. A destination ending in a slash
+// is a directory, so the base name of the source is appended (unless the
+// source also ends in a slash, in which case only its contents are copied.)
+func installedPath(src, dest string) string {
+	if strings.HasSuffix(dest, "/") && !strings.HasSuffix(src, "/") {
+		return path.Join(dest, filepath.Base(src))
+	}
+	return path.Clean(dest)
+}
+
+// expandTarget turns a single rendered target into concrete mappings. Sources
+// may be glob patterns (in which case every match is installed into Dest as a
+// directory), and directories are walked file by file when the target has
+// exclusions.
+func (f *FPM) expandTarget(i int, target Target, src, dest string) ([]targetMapping, error) {
+	logger := f.Package.logger.WithFields(logrus.Fields{
+		"index": i,
+		"name":  src,
+	})
+
+	// symlinks and directories don't refer to anything on disk
+	if target.Type == TargetSymlink || target.Type == TargetDir {
+		return []targetMapping{{src, dest, target}}, nil
+	}
+
+	sources := []string{}
+	if strings.ContainsAny(src, "*?[") {
+		matches, err := filepath.Glob(src)
+		if err != nil {
+			logger.WithError(err).Error("bad glob pattern in target source")
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if !matchAny(target.Exclude, filepath.Base(match)) && !matchAny(target.Exclude, match) {
+				sources = append(sources, match)
+			}
+		}
+
+		if !strings.HasSuffix(dest, "/") {
+			dest += "/"
+		}
+	} else if _, err := os.Lstat(src); err == nil {
+		sources = append(sources, src)
+	} else if !os.IsNotExist(err) {
+		logger.WithError(err).Error("error reading target")
+		return nil, err
+	}
+
+	if len(sources) == 0 {
+		if target.Optional {
+			logger.Debug("optional target matched no files, skipping")
+			return nil, nil
+		}
+		logger.Error(ErrNoMatches)
+		return nil, ErrNoMatches
+	}
+
+	mappings := []targetMapping{}
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			logger.WithError(err).Error("error reading target")
+			return nil, err
+		}
+
+		// templated directories handle exclusions while rendering
+		if !info.IsDir() || len(target.Exclude) == 0 || target.Template {
+			mappings = append(mappings, targetMapping{source, dest, target})
+			continue
+		}
+
+		expanded, err := expandDir(target, source, dest)
+		if err != nil {
+			logger.WithError(err).Error("error reading target directory")
+			return nil, err
+		}
+		mappings = append(mappings, expanded...)
+	}
+
+	return mappings, nil
+}
+
+// expandDir lists every file under src that is not excluded by the target,
+// mapped to its location under dest.
+func expandDir(target Target, src, dest string) ([]targetMapping, error) {
+	mappings := []targetMapping{}
+
+	root := dest
+	if !strings.HasSuffix(src, "/") {
+		root = path.Join(dest, filepath.Base(src))
+	}
+
+	err := filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, name)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if matchAny(target.Exclude, rel) || matchAny(target.Exclude, info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		mappings = append(mappings, targetMapping{name, path.Join(root, filepath.ToSlash(rel)), target})
+		return nil
+	})
+
+	return mappings, err
+}
+
+// matchAny checks a name against a list of filepath.Match patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stageTarget prepares a single target for FPM. Targets that need to be
+// changed before packaging (templated, or with a mode, or that don't exist on
+// disk like symlinks and directories) are created under TargetRoot. It
+// returns the mapping that should be handed to FPM.
+func (f *FPM) stageTarget(id string, target Target, src, dest string) (targetMapping, error) {
+	p := f.Package
+	logger := p.logger.WithFields(logrus.Fields{
+		"index": id,
+		"name":  src,
+	})
+	mapping := targetMapping{src, dest, target}
+
+	var mode os.FileMode
+	if target.Mode != "" {
+		parsed, err := parseMode(target.Mode)
+		if err != nil {
+			logger.WithField("mode", target.Mode).Error(err)
+			return mapping, err
+		}
+		mode = parsed
+	}
+
+	switch target.Type {
+	case TargetSymlink:
+		link, err := f.stagePath(id, path.Base(dest))
+		if err != nil {
+			return mapping, err
+		}
+
+		err = os.Symlink(src, link)
+		if err != nil {
+			logger.WithError(err).Error("error creating symlink")
+			return mapping, err
+		}
+
+		mapping.Src = link
+		mapping.Dest = path.Clean(dest)
+
+	case TargetDir:
+		dir, err := f.stagePath(id, path.Base(dest))
+		if err != nil {
+			return mapping, err
+		}
+
+		if mode == 0 {
+			mode = 0755
+		}
+		err = os.Mkdir(dir, mode)
+		if err == nil {
+			err = os.Chmod(dir, mode) // not subject to umask
+		}
+		if err != nil {
+			logger.WithError(err).Error("error creating directory")
+			return mapping, err
+		}
+
+		mapping.Src = dir + "/"
+		mapping.Dest = path.Clean(dest)
+
+	case "", TargetFile:
+		info, err := os.Stat(src)
+		if err != nil {
+			logger.WithError(err).Error("error reading target")
+			return mapping, err
+		}
+		if mode == 0 {
+			mode = info.Mode().Perm()
+		}
+
+		// opt-in templating. We don't want to template *every* file because some
+		// things look like Go templates and aren't (see for example every other
+		// kind of mustache template)
+		if target.Template && info.IsDir() {
+			staged, err := f.stagePath(id, path.Base(src))
+			if err != nil {
+				return mapping, err
+			}
+
+			err = f.renderTree(target, src, staged)
+			if err == nil && target.Mode != "" {
+				err = os.Chmod(staged, mode)
+			}
+			if err != nil {
+				logger.WithError(err).Error("error templating directory")
+				return mapping, err
+			}
+
+			if strings.HasSuffix(src, "/") {
+				staged += "/"
+			}
+			mapping.Src = staged
+		} else if target.Template {
+			staged, err := f.stagePath(id, path.Base(src))
+			if err != nil {
+				return mapping, err
+			}
+
+			err = f.renderFile(src, staged, mode)
+			if err != nil {
+				return mapping, err
+			}
+			mapping.Src = staged
+		} else if target.Mode != "" {
+			staged, err := f.stagePath(id, path.Base(src))
+			if err != nil {
+				return mapping, err
+			}
+
+			err = copyTree(src, staged)
+			if err == nil {
+				err = os.Chmod(staged, mode)
+			}
+			if err != nil {
+				logger.WithError(err).Error("error copying target")
+				return mapping, err
+			}
+
+			if info.IsDir() && strings.HasSuffix(src, "/") {
+				staged += "/"
+			}
+			mapping.Src = staged
+		}
+
+	default:
+		logger.WithField("type", target.Type).Error(ErrBadTargetType)
+		return mapping, ErrBadTargetType
+	}
+
+	return mapping, nil
+}
+
+// stagePath returns a location for a staged file under TargetRoot. Every
+// target gets its own directory so that names never collide.
+func (f *FPM) stagePath(id, name string) (string, error) {
+	dir := path.Join(f.Package.TargetRoot, id)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		f.Package.logger.WithError(err).Error("error creating staging directory")
+	}
+	return path.Join(dir, name), err
+}
+
+// renderFile renders the content of src as a template and writes it to dest
+func (f *FPM) renderFile(src, dest string, mode os.FileMode) error {
+	p := f.Package
+
+	rawContent, err := ioutil.ReadFile(src)
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"name":  src,
+			"error": err,
+		}).Error("error reading content")
+		return err
+	}
+
+	content, err := p.template.RenderField(src, string(rawContent))
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"name":  src,
+			"error": err,
+		}).Error("error templating content")
+		return err
+	}
+
+	err = ioutil.WriteFile(dest, content.Bytes(), mode)
+	if err == nil {
+		err = os.Chmod(dest, mode) // not subject to umask
+	}
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"name":  src,
+			"error": err,
+		}).Error("error writing content")
+	}
+	return err
+}
+
+// renderTree copies a directory to dest, keeping its layout. Files selected by
+// the target's TemplateInclude and TemplateExclude patterns are rendered as
+// templates on the way, and anything matching Exclude is left out.
+func (f *FPM) renderTree(target Target, src, dest string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+
+		if rel != "." && (matchAny(target.Exclude, rel) || matchAny(target.Exclude, info.Name())) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		out := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			err := os.MkdirAll(out, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			return os.Chmod(out, info.Mode().Perm())
+
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, out)
+
+		case target.rendersFile(rel):
+			return f.renderFile(name, out, info.Mode().Perm())
+
+		default:
+			return copyFile(name, out, info.Mode().Perm())
+		}
+	})
+}
+
+// rendersFile decides whether a file inside a templated directory should be
+// rendered. Without any TemplateInclude patterns, every file that isn't
+// matched by TemplateExclude is.
+func (t Target) rendersFile(rel string) bool {
+	base := filepath.Base(rel)
+
+	if len(t.TemplateInclude) > 0 && !matchAny(t.TemplateInclude, rel) && !matchAny(t.TemplateInclude, base) {
+		return false
+	}
+
+	return !matchAny(t.TemplateExclude, rel) && !matchAny(t.TemplateExclude, base)
+}
+
+// copyTree copies a file or directory (recursively), keeping modes and
+// symlinks intact
+func copyTree(src, dest string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			err := os.MkdirAll(target, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		default:
+			return copyFile(name, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Chmod(dest, mode)
+}
+
+// targetAttrs turns the mode, user and group set on targets into Attrs for
+// their installed paths
+func (f *FPM) targetAttrs() []Attr {
+	attrs := []Attr{}
+
+	for _, mapping := range f.mappings {
+		target := mapping.Target
+		if target.Mode == "" && target.User == "" && target.Group == "" {
+			continue
+		}
+
+		file := installedPath(mapping.Src, mapping.Dest)
+		if target.Type == TargetSymlink || target.Type == TargetDir {
+			file = path.Clean(mapping.Dest)
+		}
+
+		attrs = append(attrs, Attr{
+			File:  file,
+			Mode:  target.Mode,
+			User:  target.User,
+			Group: target.Group,
+		})
+	}
+
+	return attrs
+}
+
+// ownershipScript returns shell commands that set the owners declared on
+// targets. FPM can only set per-file owners for RPMs (with --rpm-attr), so for
+// other package types the owners are set after installation instead.
+func (f *FPM) ownershipScript(outType string) string {
+	if outType == "rpm" {
+		return ""
+	}
+
+	lines := []string{}
+	for _, attr := range f.targetAttrs() {
+		owner := attr.User
+		if attr.Group != "" {
+			owner += ":" + attr.Group
+		}
+		if owner == "" {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("chown -h %s %s", shellQuote(owner), shellQuote(attr.File)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// shellQuote quotes a string for use as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
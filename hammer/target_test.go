@@ -0,0 +1,498 @@
+package hammer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTree creates the given files (with their modes) under dir
+func writeTree(t *testing.T, dir string, files map[string]os.FileMode) {
+	for name, mode := range files {
+		full := path.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(path.Dir(full), 0755))
+		assert.Nil(t, ioutil.WriteFile(full, []byte(name+"\n"), mode))
+		assert.Nil(t, os.Chmod(full, mode))
+	}
+}
+
+func newTargetFPM(dir string) *FPM {
+	p := NewPackage()
+	p.TargetRoot = path.Join(dir, "target")
+	return &FPM{Package: p}
+}
+
+func TestExpandTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]os.FileMode{
+		"bin/consul":       0755,
+		"bin/consul.debug": 0644,
+		"ui/index.html":    0644,
+		"ui/app.js":        0644,
+	})
+	in := func(name string) string { return path.Join(dir, name) }
+
+	cases := []struct {
+		name     string
+		target   Target
+		src      string
+		dest     string
+		expected []targetMapping
+	}{
+		{
+			"file",
+			Target{},
+			in("bin/consul"), "/usr/bin/",
+			[]targetMapping{{in("bin/consul"), "/usr/bin/", Target{}}},
+		},
+		{
+			"glob",
+			Target{},
+			in("bin/*"), "/usr/bin",
+			[]targetMapping{
+				{in("bin/consul"), "/usr/bin/", Target{}},
+				{in("bin/consul.debug"), "/usr/bin/", Target{}},
+			},
+		},
+		{
+			"glob with exclude",
+			Target{Exclude: []string{"*.debug"}},
+			in("bin/*"), "/usr/bin/",
+			[]targetMapping{{in("bin/consul"), "/usr/bin/", Target{Exclude: []string{"*.debug"}}}},
+		},
+		{
+			"directory",
+			Target{},
+			in("ui"), "/usr/share/consul/",
+			[]targetMapping{{in("ui"), "/usr/share/consul/", Target{}}},
+		},
+		{
+			"directory with exclude",
+			Target{Exclude: []string{"*.js"}},
+			in("ui"), "/usr/share/consul/",
+			[]targetMapping{{in("ui/index.html"), "/usr/share/consul/ui/index.html", Target{Exclude: []string{"*.js"}}}},
+		},
+		{
+			"optional",
+			Target{Optional: true},
+			in("bin/missing"), "/usr/bin/",
+			nil,
+		},
+		{
+			"optional glob",
+			Target{Optional: true},
+			in("lib/*.so"), "/usr/lib/",
+			nil,
+		},
+		{
+			"symlink",
+			Target{Type: TargetSymlink},
+			"/opt/consul/bin/consul", "/usr/bin/consul",
+			[]targetMapping{{"/opt/consul/bin/consul", "/usr/bin/consul", Target{Type: TargetSymlink}}},
+		},
+		{
+			"dir",
+			Target{Type: TargetDir, Mode: "0750"},
+			"", "/var/lib/consul",
+			[]targetMapping{{"", "/var/lib/consul", Target{Type: TargetDir, Mode: "0750"}}},
+		},
+	}
+
+	f := newTargetFPM(dir)
+	for _, c := range cases {
+		mappings, err := f.expandTarget(0, c.target, c.src, c.dest)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.expected, mappings, c.name)
+	}
+
+	for _, src := range []string{in("bin/missing"), in("lib/*.so"), in("bin/*.exe")} {
+		_, err := f.expandTarget(0, Target{}, src, "/usr/bin/")
+		assert.Equal(t, ErrNoMatches, err, src)
+	}
+
+	// a glob whose matches are all excluded matches nothing
+	_, err = f.expandTarget(0, Target{Exclude: []string{"consul*"}}, in("bin/*"), "/usr/bin/")
+	assert.Equal(t, ErrNoMatches, err)
+}
+
+func TestExpandDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]os.FileMode{
+		"ui/index.html":        0644,
+		"ui/static/app.js":     0644,
+		"ui/static/app.js.map": 0644,
+		"ui/test/index.html":   0644,
+	})
+	in := func(name string) string { return path.Join(dir, name) }
+
+	cases := []struct {
+		src      string
+		exclude  []string
+		expected map[string]string
+	}{
+		{
+			in("ui"), []string{"*.map"},
+			map[string]string{
+				in("ui/index.html"):      "/srv/ui/index.html",
+				in("ui/static/app.js"):   "/srv/ui/static/app.js",
+				in("ui/test/index.html"): "/srv/ui/test/index.html",
+			},
+		},
+		{
+			// with a trailing slash only the contents are installed
+			in("ui") + "/", []string{"*.map"},
+			map[string]string{
+				in("ui/index.html"):      "/srv/index.html",
+				in("ui/static/app.js"):   "/srv/static/app.js",
+				in("ui/test/index.html"): "/srv/test/index.html",
+			},
+		},
+		{
+			// excluding a directory skips everything in it
+			in("ui"), []string{"test", "static/*.map"},
+			map[string]string{
+				in("ui/index.html"):    "/srv/ui/index.html",
+				in("ui/static/app.js"): "/srv/ui/static/app.js",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		target := Target{Exclude: c.exclude}
+		mappings, err := expandDir(target, c.src, "/srv")
+		assert.Nil(t, err, c.src)
+
+		actual := map[string]string{}
+		for _, mapping := range mappings {
+			assert.Equal(t, target, mapping.Target)
+			actual[mapping.Src] = mapping.Dest
+		}
+		assert.Equal(t, c.expected, actual, c.src)
+	}
+}
+
+func TestStageTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]os.FileMode{
+		"bin/consul":        0755,
+		"etc/consul.json":   0644,
+		"ui/index.html":     0644,
+		"ui/static/app.css": 0644,
+	})
+	in := func(name string) string { return path.Join(dir, name) }
+	staged := func(id, name string) string { return path.Join(dir, "target", id, name) }
+
+	cases := []struct {
+		id     string
+		target Target
+		src    string
+		dest   string
+
+		// expected mapping, and the mode of what it points to
+		mapping targetMapping
+		mode    os.FileMode
+	}{
+		{
+			"file", Target{},
+			in("bin/consul"), "/usr/bin/",
+			targetMapping{in("bin/consul"), "/usr/bin/", Target{}}, 0755,
+		},
+		{
+			"mode", Target{Mode: "0600"},
+			in("etc/consul.json"), "/etc/consul/",
+			targetMapping{staged("mode", "consul.json"), "/etc/consul/", Target{Mode: "0600"}}, 0600,
+		},
+		{
+			"dir-mode", Target{Mode: "0700"},
+			in("ui") + "/", "/srv/ui/",
+			targetMapping{staged("dir-mode", "ui") + "/", "/srv/ui/", Target{Mode: "0700"}}, 0700,
+		},
+		{
+			"dir", Target{Type: TargetDir},
+			"", "/var/lib/consul/",
+			targetMapping{staged("dir", "consul") + "/", "/var/lib/consul", Target{Type: TargetDir}}, 0755,
+		},
+		{
+			"dir-with-mode", Target{Type: TargetDir, Mode: "0750"},
+			"", "/var/lib/consul",
+			targetMapping{staged("dir-with-mode", "consul") + "/", "/var/lib/consul", Target{Type: TargetDir, Mode: "0750"}}, 0750,
+		},
+	}
+
+	f := newTargetFPM(dir)
+	for _, c := range cases {
+		mapping, err := f.stageTarget(c.id, c.target, c.src, c.dest)
+		assert.Nil(t, err, c.id)
+		assert.Equal(t, c.mapping, mapping, c.id)
+
+		info, err := os.Stat(mapping.Src)
+		if assert.Nil(t, err, c.id) {
+			assert.Equal(t, c.mode, info.Mode().Perm(), c.id)
+		}
+	}
+
+	// the copy of a directory with a mode keeps the modes of its contents
+	info, err := os.Stat(staged("dir-mode", "ui/static/app.css"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// symlinks point at the source, which doesn't need to exist at build time
+	mapping, err := f.stageTarget("symlink", Target{Type: TargetSymlink}, "/opt/consul/bin/consul", "/usr/bin/consul/")
+	assert.Nil(t, err)
+	assert.Equal(t, targetMapping{staged("symlink", "consul"), "/usr/bin/consul", Target{Type: TargetSymlink}}, mapping)
+	link, err := os.Readlink(mapping.Src)
+	assert.Nil(t, err)
+	assert.Equal(t, "/opt/consul/bin/consul", link)
+
+	_, err = f.stageTarget("bad-type", Target{Type: "socket"}, in("bin/consul"), "/usr/bin/")
+	assert.Equal(t, ErrBadTargetType, err)
+
+	_, err = f.stageTarget("bad-mode", Target{Mode: "rwxr-xr-x"}, in("bin/consul"), "/usr/bin/")
+	assert.Equal(t, ErrBadMode, err)
+
+	_, err = f.stageTarget("missing", Target{}, in("bin/missing"), "/usr/bin/")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCopyTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]os.FileMode{
+		"src/bin/consul":      0755,
+		"src/etc/consul.json": 0600,
+	})
+	assert.Nil(t, os.Symlink("bin/consul", path.Join(dir, "src/consul")))
+	assert.Nil(t, os.Chmod(path.Join(dir, "src/etc"), 0700))
+
+	assert.Nil(t, copyTree(path.Join(dir, "src"), path.Join(dir, "dest")))
+
+	cases := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"dest", 0755},
+		{"dest/bin", 0755},
+		{"dest/bin/consul", 0755},
+		{"dest/etc", 0700},
+		{"dest/etc/consul.json", 0600},
+	}
+	for _, c := range cases {
+		info, err := os.Stat(path.Join(dir, c.name))
+		if assert.Nil(t, err, c.name) {
+			assert.Equal(t, c.mode, info.Mode().Perm(), c.name)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path.Join(dir, "dest/bin/consul"))
+	assert.Nil(t, err)
+	assert.Equal(t, "src/bin/consul\n", string(content))
+
+	link, err := os.Readlink(path.Join(dir, "dest/consul"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bin/consul", link)
+
+	// single files are copied too
+	assert.Nil(t, copyTree(path.Join(dir, "src/etc/consul.json"), path.Join(dir, "consul.json")))
+	info, err := os.Stat(path.Join(dir, "consul.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestRenderTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	const (
+		consulJSON = "{\n  \"datacenter\": \"dc1\",\n  \"data_dir\": \"/var/lib/consul\"\n}\n"
+		startSh    = "#!/bin/sh\nexec consul agent -dc dc1 -config-dir /etc/consul\n"
+		indexHTML  = "<h1>consul 0.5.2</h1>\n"
+		rawJSON    = "{\n  \"datacenter\": \"{{.Vars.dc}}\",\n  \"data_dir\": \"/var/lib/{{.Name}}\"\n}\n"
+		rawStartSh = "#!/bin/sh\nexec consul agent -dc {{.Vars.dc}} -config-dir /etc/{{.Name}}\n"
+		rawIndex   = "<h1>{{.Name}} {{.Version}}</h1>\n"
+		appJS      = "var greeting = \"Hello, {{user.name}}\";\n"
+	)
+
+	cases := []struct {
+		name     string
+		target   Target
+		expected map[string]string
+	}{
+		{
+			"exclude",
+			Target{Template: true, Exclude: []string{"ui"}},
+			map[string]string{
+				"consul.json":      consulJSON,
+				"scripts/start.sh": startSh,
+			},
+		},
+		{
+			"template-exclude",
+			Target{Template: true, TemplateExclude: []string{"*.js"}},
+			map[string]string{
+				"consul.json":      consulJSON,
+				"scripts/start.sh": startSh,
+				"ui/app.js":        appJS,
+				"ui/index.html":    indexHTML,
+			},
+		},
+		{
+			"template-include",
+			Target{Template: true, TemplateInclude: []string{"*.json", "ui/*"}, TemplateExclude: []string{"ui/*.js"}},
+			map[string]string{
+				"consul.json":      consulJSON,
+				"scripts/start.sh": rawStartSh,
+				"ui/app.js":        appJS,
+				"ui/index.html":    indexHTML,
+			},
+		},
+		{
+			"template-include by path",
+			Target{Template: true, TemplateInclude: []string{"scripts/*.sh"}},
+			map[string]string{
+				"consul.json":      rawJSON,
+				"scripts/start.sh": startSh,
+				"ui/app.js":        appJS,
+				"ui/index.html":    rawIndex,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		p := NewPackage()
+		p.Name = "consul"
+		p.Version = "0.5.2"
+		p.Vars = Vars{"dc": "dc1"}
+		f := &FPM{Package: p}
+
+		dest := path.Join(dir, c.name)
+		assert.Nil(t, f.renderTree(c.target, "testdata/templates/consul", dest), c.name)
+
+		actual := map[string]string{}
+		err := filepath.Walk(dest, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			content, err := ioutil.ReadFile(name)
+			rel, _ := filepath.Rel(dest, name)
+			actual[filepath.ToSlash(rel)] = string(content)
+			return err
+		})
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.expected, actual, c.name)
+
+		// rendered files keep their modes
+		info, err := os.Stat(path.Join(dest, "scripts/start.sh"))
+		if assert.Nil(t, err, c.name) {
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), c.name)
+		}
+	}
+}
+
+func TestRenderTreeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-target-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p := NewPackage()
+	p.TargetRoot = dir
+	p.Vars = Vars{"dc": "dc1"}
+	f := &FPM{Package: p}
+
+	// the error names the file that failed to render
+	err = f.renderTree(Target{Template: true}, "testdata/templates/broken", path.Join(dir, "broken"))
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "testdata/templates/broken/conf.d/server.conf, line 1: "), err.Error())
+	}
+
+	// and is left alone when the file isn't rendered
+	err = f.renderTree(Target{Template: true, TemplateExclude: []string{"conf.d/*"}}, "testdata/templates/broken", path.Join(dir, "excluded"))
+	assert.Nil(t, err)
+
+	// templated directories are rendered while staging
+	mapping, err := f.stageTarget("ui", Target{Template: true, TemplateInclude: []string{"*.html"}}, "testdata/templates/consul/ui/", "/srv/ui/")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(dir, "ui/ui")+"/", mapping.Src)
+
+	_, err = f.stageTarget("broken", Target{Template: true}, "testdata/templates/broken", "/etc/consul/")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "testdata/templates/broken/conf.d/server.conf")
+	}
+}
+
+func TestTargetAttrs(t *testing.T) {
+	f := &FPM{Package: NewPackage(), mappings: []targetMapping{
+		{"build/consul", "/usr/bin/", Target{Mode: "0750", User: "consul"}},
+		{"build/consul.json", "/etc/consul/consul.json", Target{Group: "consul"}},
+		{"build/README", "/usr/share/doc/consul/", Target{}},
+		{"/opt/consul/bin/consul", "/usr/local/bin/consul/", Target{Type: TargetSymlink, User: "root", Group: "wheel"}},
+		{"target/3/consul/", "/var/lib/consul", Target{Type: TargetDir, Mode: "0700", User: "consul", Group: "consul"}},
+		{"build/my app", "/opt/it's here/", Target{User: "app user", Group: "o'brien"}},
+	}}
+
+	assert.Equal(t, []Attr{
+		{File: "/usr/bin/consul", Mode: "0750", User: "consul"},
+		{File: "/etc/consul/consul.json", Group: "consul"},
+		{File: "/usr/local/bin/consul", User: "root", Group: "wheel"},
+		{File: "/var/lib/consul", Mode: "0700", User: "consul", Group: "consul"},
+		{File: "/opt/it's here/my app", User: "app user", Group: "o'brien"},
+	}, f.targetAttrs())
+
+	// RPMs get their owners from --rpm-attr instead
+	assert.Equal(t, "", f.ownershipScript("rpm"))
+
+	// targets that only set a mode don't need chown
+	assert.Equal(t, `chown -h 'consul' '/usr/bin/consul'
+chown -h ':consul' '/etc/consul/consul.json'
+chown -h 'root:wheel' '/usr/local/bin/consul'
+chown -h 'consul:consul' '/var/lib/consul'
+chown -h 'app user:o'\''brien' '/opt/it'\''s here/my app'`, f.ownershipScript("deb"))
+
+	f.mappings = []targetMapping{{"build/consul", "/usr/bin/", Target{Mode: "0755"}}}
+	assert.Equal(t, "", f.ownershipScript("deb"))
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"", `''`},
+		{"consul", `'consul'`},
+		{"/opt/my app", `'/opt/my app'`},
+		{"it's", `'it'\''s'`},
+		{`say "hi"`, `'say "hi"'`},
+		{"$HOME `id`", "'$HOME `id`'"},
+		{"''", `''\'''\'''`},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.out, shellQuote(c.in), c.in)
+	}
+
+	// and the quoted words come back out of a shell unchanged
+	if _, err := exec.LookPath("sh"); err != nil {
+		return
+	}
+	for _, c := range cases {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(c.in)).Output()
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.in, string(out), c.in)
+	}
+}
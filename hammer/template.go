@@ -2,16 +2,93 @@ package hammer
 
 import (
 	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+var (
+	// ErrMissingEnv is returned by the env template function when a variable
+	// is not set and no default was given.
+	ErrMissingEnv = errors.New("environment variable is not set")
 )
 
 // Template controls template rendering within a Package
 type Template struct {
 	Package *Package
 	Funcs   template.FuncMap
+
+	// Strict makes referring to a missing map key (like an undefined entry in
+	// .Vars or .Matrix) an error instead of rendering "<no value>".
+	Strict bool
+}
+
+// TemplateError is returned when a template fails to parse or render. It names
+// the spec field (or file) that was being rendered and the line in it. Line
+// counts from the start of the field's value, not from the top of the spec
+// file, since a field may come from a base spec, an include or an override.
+type TemplateError struct {
+	Field   string
+	Line    int
+	Message string
+}
+
+func (e *TemplateError) Error() string {
+	location := e.Field
+	if location == "" {
+		location = "template"
+	}
+	if e.Line > 0 {
+		location += fmt.Sprintf(", line %d", e.Line)
+	}
+	return location + ": " + e.Message
+}
+
+// text/template prefixes errors with "template: name:line[:col]: "
+var templateErrorRe = regexp.MustCompile(`(?s)^template: [^:]*:(\d+)(?::\d+)?: (.*)$`)
+
+func newTemplateError(field string, err error) error {
+	e := &TemplateError{Field: field, Message: err.Error()}
+	if match := templateErrorRe.FindStringSubmatch(err.Error()); match != nil {
+		e.Line, _ = strconv.Atoi(match[1])
+		e.Message = match[2]
+	}
+	return e
+}
+
+// TemplateCacheSize is the number of parsed templates kept for reuse. The
+// least recently used ones are dropped beyond that.
+const TemplateCacheSize = 1024
+
+// parsed templates are shared between all packages, keyed by the SHA256 of
+// their source. Each use gets a clone with the functions of the package
+// rendering it.
+var templateCache = struct {
+	sync.Mutex
+	parsed map[[sha256.Size]byte]*list.Element
+	order  *list.List // of *cachedTemplate, most recently used first
+}{
+	parsed: map[[sha256.Size]byte]*list.Element{},
+	order:  list.New(),
+}
+
+type cachedTemplate struct {
+	key  [sha256.Size]byte
+	tmpl *template.Template
 }
 
 // NewTemplate takes a Package and returns a configured Template.
@@ -26,6 +103,21 @@ func NewTemplate(pkg *Package) *Template {
 		"specFile":        t.SpecFile,
 		"top":             t.Top,
 		"variable":        t.Variable,
+
+		// general purpose
+		"date":       Date,
+		"default":    Default,
+		"env":        Env,
+		"join":       Join,
+		"lower":      strings.ToLower,
+		"now":        time.Now,
+		"replace":    Replace,
+		"semver":     Semver,
+		"sha256":     SHA256,
+		"split":      Split,
+		"trimPrefix": TrimPrefix,
+		"trimSuffix": TrimSuffix,
+		"upper":      strings.ToUpper,
 	}
 
 	return t
@@ -35,14 +127,62 @@ func NewTemplate(pkg *Package) *Template {
 // buffer. This can be read with `bytes.Buffer.String()` or
 // `bytes.Buffer.Bytes()`
 func (t *Template) Render(in string) (bytes.Buffer, error) {
+	return t.RenderField("", in)
+}
+
+// RenderField is like Render, but for the contents of a named spec field (like
+// "scripts.build") or file. Errors are a *TemplateError naming the field and
+// the line that failed.
+func (t *Template) RenderField(field, in string) (bytes.Buffer, error) {
 	var buf bytes.Buffer
-	tmpl, err := template.New(in).Funcs(t.Funcs).Parse(in)
+
+	tmpl, err := t.parse(in)
 	if err != nil {
-		return buf, err
+		return buf, newTemplateError(field, err)
+	}
+
+	if t.Strict {
+		tmpl.Option("missingkey=error")
 	}
 
 	err = tmpl.Execute(&buf, t.Package)
-	return buf, err
+	if err != nil {
+		return buf, newTemplateError(field, err)
+	}
+	return buf, nil
+}
+
+// parse returns a parsed template for in, from the cache if it has been seen
+// before. The result is safe to modify.
+func (t *Template) parse(in string) (*template.Template, error) {
+	key := sha256.Sum256([]byte(in))
+
+	templateCache.Lock()
+	defer templateCache.Unlock()
+
+	var tmpl *template.Template
+	if elem, ok := templateCache.parsed[key]; ok {
+		templateCache.order.MoveToFront(elem)
+		tmpl = elem.Value.(*cachedTemplate).tmpl
+	} else {
+		var err error
+		tmpl, err = template.New("spec").Funcs(t.Funcs).Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		templateCache.parsed[key] = templateCache.order.PushFront(&cachedTemplate{key, tmpl})
+		for templateCache.order.Len() > TemplateCacheSize {
+			oldest := templateCache.order.Remove(templateCache.order.Back()).(*cachedTemplate)
+			delete(templateCache.parsed, oldest.key)
+		}
+	}
+
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(t.Funcs), nil
 }
 
 // template functions
@@ -65,7 +205,7 @@ func (t *Template) IncludeTemplate(path string) (string, error) {
 		return "", err
 	}
 
-	rendered, err := t.Render(tmpl)
+	rendered, err := t.RenderField(path, tmpl)
 	return rendered.String(), err
 }
 
@@ -100,11 +240,101 @@ func (t *Template) Top() *Package {
 }
 
 // Variable inserts an extra variable that was passed into the template via the
-// spec.
-func (t *Template) Variable(name string) (string, error) {
-	value, ok := t.Package.Vars[name]
+// spec. The name can be a dotted path into nested vars, like "urls.x86_64".
+func (t *Template) Variable(name string) (interface{}, error) {
+	value, ok := t.Package.Vars.Lookup(name)
 	if !ok {
-		return "", errors.New("Undefined variable in template: " + name)
+		return nil, errors.New("Undefined variable in template: " + name)
 	}
 	return value, nil
 }
+
+// general purpose template functions. Arguments are ordered so that the value
+// being worked on comes last, so they can be used in pipelines like
+// `{{.Version | replace "." "_"}}`
+
+// Replace (replace) is a template function that replaces every occurrence of
+// old in s with new
+func Replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// TrimPrefix (trimPrefix) is a template function that removes prefix from the
+// start of s, if present
+func TrimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+// TrimSuffix (trimSuffix) is a template function that removes suffix from the
+// end of s, if present
+func TrimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+// Split (split) is a template function that splits s on every sep
+func Split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// Join (join) is a template function that joins a list of strings with sep
+func Join(sep string, parts []string) string {
+	return strings.Join(parts, sep)
+}
+
+// Semver (semver) is a template function that parses a semantic version, so
+// its parts can be used like `{{(semver .Version).Major}}`. A leading "v" and
+// missing minor or patch versions are allowed. Unparseable versions are an
+// error.
+func Semver(version string) (semver.Version, error) {
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return v, fmt.Errorf("could not parse %q as a semantic version: %s", version, err)
+	}
+	return v, nil
+}
+
+// Env (env) is a template function that returns the value of an environment
+// variable. If the variable is not set, the optional default is returned
+// instead, and without a default it is an error.
+func Env(name string, def ...string) (string, error) {
+	if len(def) > 1 {
+		return "", fmt.Errorf("env takes at most one default, got %d", len(def))
+	}
+
+	value, ok := os.LookupEnv(name)
+	if ok {
+		return value, nil
+	}
+	if len(def) == 1 {
+		return def[0], nil
+	}
+	return "", fmt.Errorf("%s: %s", ErrMissingEnv, name)
+}
+
+// SHA256 (sha256) is a template function that returns the hex-encoded SHA256
+// checksum of a file
+func SHA256(name string) (string, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Date (date) is a template function that formats a time with a Go time
+// layout, like `{{now | date "2006-01-02"}}`
+func Date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// Default (default) is a template function that returns def if value is empty
+// (unset, zero, or an empty string, list or map), and value otherwise. Use it
+// like `{{.Vars.port | default "8080"}}`.
+func Default(def interface{}, value interface{}) interface{} {
+	if value == nil || isEmptyValue(reflect.ValueOf(value)) {
+		return def
+	}
+	return value
+}
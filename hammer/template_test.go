@@ -0,0 +1,197 @@
+package hammer
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-template-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "file")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+	os.Setenv("HAMMER_TEMPLATE_TEST", "set")
+	defer os.Unsetenv("HAMMER_TEMPLATE_TEST")
+	os.Unsetenv("HAMMER_TEMPLATE_UNSET")
+
+	p := NewPackage()
+	p.Name = "Consul"
+	p.Version = "v0.5.2"
+	p.Vars = Vars{"port": "8500"}
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{`{{.Version | replace "." "_"}}`, "v0_5_2"},
+		{`{{.Version | trimPrefix "v"}}`, "0.5.2"},
+		{`{{.Name | trimSuffix "ul"}}`, "Cons"},
+		{`{{.Name | lower}}-{{.Name | upper}}`, "consul-CONSUL"},
+		{`{{index (.Version | split ".") 1}}`, "5"},
+		{`{{split "." .Version | join "-"}}`, "v0-5-2"},
+		{`{{(semver .Version).Major}}.{{(semver .Version).Minor}}`, "0.5"},
+		{`{{(semver "1.2").Patch}}`, "0"},
+		{`{{env "HAMMER_TEMPLATE_TEST"}}`, "set"},
+		{`{{env "HAMMER_TEMPLATE_UNSET" "fallback"}}`, "fallback"},
+		{`{{sha256 "` + file + `"}}`, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{`{{.Vars.port | default "80"}}`, "8500"},
+		{`{{.Vars.missing | default "80"}}`, "80"},
+		{`{{.Epoch | default "0"}}`, "0"},
+		{`{{now | date "2006"}}`, time.Now().Format("2006")},
+	}
+
+	for _, c := range cases {
+		out, err := p.Render(c.in)
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.out, out.String(), c.in)
+	}
+}
+
+func TestTemplateFuncErrors(t *testing.T) {
+	os.Unsetenv("HAMMER_TEMPLATE_UNSET")
+
+	p := NewPackage()
+	p.Version = "latest"
+
+	cases := []struct {
+		in      string
+		message string
+	}{
+		{`{{env "HAMMER_TEMPLATE_UNSET"}}`, "HAMMER_TEMPLATE_UNSET"},
+		{`{{env "HAMMER_TEMPLATE_UNSET" "a" "b"}}`, "at most one default"},
+		{`{{(semver .Version).Major}}`, `"latest"`},
+		{`{{sha256 "/nonexistent/hammer"}}`, "no such file"},
+	}
+
+	for _, c := range cases {
+		_, err := p.Render(c.in)
+		if assert.NotNil(t, err, c.in) {
+			assert.True(t, strings.Contains(err.Error(), c.message), err.Error())
+		}
+	}
+}
+
+func TestTemplateStrict(t *testing.T) {
+	p := NewPackage()
+	p.Vars = Vars{"port": "8500"}
+
+	out, err := p.Render(`{{.Vars.missing}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "<no value>", out.String())
+
+	p.template.Strict = true
+	_, err = p.Render(`{{.Vars.port}}`)
+	assert.Nil(t, err)
+	_, err = p.Render(`{{.Vars.missing}}`)
+	assert.NotNil(t, err)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	p := NewPackage()
+
+	_, err := p.template.RenderField("scripts.build", "make\n{{.Verison}}\n")
+	if assert.NotNil(t, err) {
+		tmplErr, ok := err.(*TemplateError)
+		if assert.True(t, ok) {
+			assert.Equal(t, "scripts.build", tmplErr.Field)
+			assert.Equal(t, 2, tmplErr.Line)
+			assert.True(t, strings.Contains(tmplErr.Message, "Verison"), tmplErr.Message)
+		}
+	}
+
+	_, err = p.template.RenderField("version", "{{nope}}")
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "version, line 1: "), err.Error())
+	}
+}
+
+func TestTemplateCacheUsesRenderingPackage(t *testing.T) {
+	a := NewPackage()
+	a.BuildRoot = "/a"
+	b := NewPackage()
+	b.BuildRoot = "/b"
+
+	in := `{{buildFile "x"}} {{.BuildRoot}}`
+	outA, err := a.Render(in)
+	assert.Nil(t, err)
+	outB, err := b.Render(in)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "/a/x /a", outA.String())
+	assert.Equal(t, "/b/x /b", outB.String())
+}
+
+func TestTemplateVars(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`
+vars:
+  packagedBy: hammer
+  port: 8500
+  dotted.name: yes
+  release: 1.10
+  mode: 0755
+  plugins: [a, b]
+  versions: [1.10, 1.9]
+  urls:
+    x86_64: https://example.com/amd64
+    arm: {v7: https://example.com/armv7}
+`))
+	assert.Nil(t, err)
+
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{`{{.Vars.packagedBy}} {{variable "packagedBy"}}`, "hammer hammer"},
+		{`{{variable "port"}}`, "8500"},
+		// scalars render as written
+		{`{{variable "dotted.name"}}`, "yes"},
+		{`{{.Vars.release}}`, "1.10"},
+		{`{{.Vars.mode}}`, "0755"},
+		{`{{range .Vars.versions}}[{{.}}]{{end}}`, "[1.10][1.9]"},
+		{`{{.Vars.urls.x86_64}}`, "https://example.com/amd64"},
+		{`{{variable "urls.arm.v7"}}`, "https://example.com/armv7"},
+		{`{{variable "plugins.1"}}`, "b"},
+		{`{{range .Vars.plugins}}[{{.}}]{{end}}`, "[a][b]"},
+	}
+
+	for _, c := range cases {
+		out, err := p.Render(c.in)
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.out, out.String(), c.in)
+	}
+
+	for _, missing := range []string{"nope", "urls.nope", "plugins.2", "packagedBy.x"} {
+		_, err := p.Render(`{{variable "` + missing + `"}}`)
+		assert.NotNil(t, err, missing)
+	}
+}
+
+func TestTemplateCacheIsBounded(t *testing.T) {
+	p := NewPackage()
+
+	first := `{{"first"}}`
+	_, err := p.Render(first)
+	assert.Nil(t, err)
+
+	for i := 0; i < TemplateCacheSize; i++ {
+		_, err := p.Render(fmt.Sprintf("{{%d}}", i))
+		assert.Nil(t, err)
+	}
+
+	templateCache.Lock()
+	defer templateCache.Unlock()
+	assert.Equal(t, TemplateCacheSize, len(templateCache.parsed))
+	assert.Equal(t, TemplateCacheSize, templateCache.order.Len())
+	assert.NotContains(t, templateCache.parsed, sha256.Sum256([]byte(first)))
+}
@@ -0,0 +1,52 @@
+%global debug_package %{nil}
+%define data_dir /var/lib/%{name}
+
+Name:           consul
+Version:        0.6.4
+Release:        2%{?dist}
+Epoch:          1
+Summary:        Consul is a tool for service discovery and configuration
+License:        MPLv2.0
+URL:            https://www.consul.io
+Vendor:         Hashicorp
+BuildArch:      x86_64
+Source0:        https://releases.hashicorp.com/%{name}/%{version}/%{name}_%{version}_linux_amd64.zip
+Source1:        %{name}.json
+Patch0:         fix-paths.patch
+BuildRequires:  unzip
+Requires:       systemd, glibc >= 2.12
+Requires(pre):  shadow-utils
+Obsoletes:      consul-server < 0.6
+
+%description
+Consul provides service discovery, health checking and a key/value store.
+
+%prep
+%setup -q -c
+
+%build
+
+%install
+mkdir -p %{buildroot}%{_bindir} %{buildroot}%{_sysconfdir}/%{name}
+install -m 0755 %{name} %{buildroot}%{_bindir}/%{name}
+install -m 0644 %{SOURCE1} %{buildroot}%{_sysconfdir}/%{name}/
+
+%pre
+getent group consul >/dev/null || groupadd -r consul
+
+%post
+%systemd_post consul.service
+
+%postun
+rm -rf %{data_dir}
+
+%files
+%defattr(-,root,root,-)
+%doc README.md
+%attr(0755,root,root) %{_bindir}/%{name}
+%config(noreplace) %{_sysconfdir}/%{name}/%{name}.json
+%dir %attr(0750,consul,consul) %{data_dir}
+
+%changelog
+* Tue Apr 19 2016 Packager <packager@example.com> - 0.6.4-2
+- Update to 0.6.4
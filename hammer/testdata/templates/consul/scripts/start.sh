@@ -0,0 +1,2 @@
+#!/bin/sh
+exec consul agent -dc {{.Vars.dc}} -config-dir /etc/{{.Name}}
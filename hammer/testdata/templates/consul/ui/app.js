@@ -0,0 +1 @@
+var greeting = "Hello, {{user.name}}";
@@ -0,0 +1,446 @@
+package hammer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/blang/semver"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNoUpstream is returned when checking a package without an upstream
+	ErrNoUpstream = errors.New("no upstream configured")
+
+	// ErrBadUpstream is returned when an upstream does not name exactly one
+	// source, or is missing a pattern or path for it.
+	ErrBadUpstream = errors.New("upstream needs one of github, or url with pattern or json-path")
+
+	// ErrNoUpstreamVersions is returned when the upstream source does not list
+	// any usable versions.
+	ErrNoUpstreamVersions = errors.New("no versions found upstream")
+
+	// ErrCannotBump is returned when the version in a spec can't be rewritten,
+	// for example because it is templated or inherited.
+	ErrCannotBump = errors.New("version is not set to a plain value in the spec")
+
+	// ErrCannotBumpFormat is returned when asked to bump a spec that is not
+	// written in YAML.
+	ErrCannotBumpFormat = errors.New("only YAML specs can be bumped")
+)
+
+// DefaultGitHubAPI is the base URL of the GitHub API
+const DefaultGitHubAPI = "https://api.github.com"
+
+// Upstream says where to look for new releases of the packaged software:
+//
+//   - GitHub is an "owner/repo" whose latest release is used
+//   - URL with Pattern is a page (like an HTML index) searched with a regular
+//     expression, whose first group (or whole match) is a version
+//   - URL with JSONPath is a JSON document, and a dotted path to the versions in
+//     it. "*" matches every item of a list or map, like "releases.*.version".
+//
+// When several versions are found, the highest is used. Pre-releases are
+// skipped unless Prereleases is set.
+type Upstream struct {
+	GitHub      string `yaml:"github,omitempty"`
+	URL         string `yaml:"url,omitempty"`
+	Pattern     string `yaml:"pattern,omitempty"`
+	JSONPath    string `yaml:"json-path,omitempty"`
+	Prereleases bool   `yaml:"prereleases,omitempty"`
+}
+
+// UpstreamStatus compares a package's version with the latest upstream
+type UpstreamStatus struct {
+	Name     string
+	Current  string
+	Latest   string
+	Outdated bool
+}
+
+// UpstreamChecker looks up the latest upstream versions of packages
+type UpstreamChecker struct {
+	Client    *http.Client
+	GitHubAPI string
+
+	// GitHubToken is sent to the GitHub API, if set, for higher rate limits
+	GitHubToken string
+}
+
+// NewUpstreamChecker returns an UpstreamChecker using the public GitHub API
+func NewUpstreamChecker() *UpstreamChecker {
+	return &UpstreamChecker{
+		Client:    &http.Client{},
+		GitHubAPI: DefaultGitHubAPI,
+	}
+}
+
+// Check compares the rendered Version of the package with the latest upstream
+// version.
+func (c *UpstreamChecker) Check(p *Package) (UpstreamStatus, error) {
+	status := UpstreamStatus{Name: p.Name}
+
+	current, err := p.template.RenderField("version", p.Version)
+	if err != nil {
+		return status, err
+	}
+	status.Current = current.String()
+
+	currentVersion, err := Semver(status.Current)
+	if err != nil {
+		return status, err
+	}
+
+	latest, err := c.Latest(p)
+	if err != nil {
+		return status, err
+	}
+	status.Latest = latest
+
+	latestVersion, err := Semver(latest)
+	if err != nil {
+		return status, err
+	}
+	status.Outdated = latestVersion.GT(currentVersion)
+
+	return status, nil
+}
+
+// Latest finds the highest version available upstream. It is returned as
+// written upstream, less any leading "v", so a tag of "v1.2" gives "1.2".
+func (c *UpstreamChecker) Latest(p *Package) (string, error) {
+	upstream := p.Upstream
+
+	var candidates []string
+	var err error
+	switch {
+	case upstream == (Upstream{}):
+		return "", ErrNoUpstream
+
+	case upstream.GitHub != "" && upstream.URL == "":
+		candidates, err = c.gitHubVersions(upstream.GitHub)
+
+	case upstream.URL != "" && upstream.GitHub == "" && (upstream.Pattern == "") != (upstream.JSONPath == ""):
+		url, err := p.template.RenderField("upstream.url", upstream.URL)
+		if err != nil {
+			return "", err
+		}
+
+		body, err := c.get(url.String(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		if upstream.Pattern != "" {
+			candidates, err = patternVersions(upstream.Pattern, body)
+		} else {
+			candidates, err = jsonVersions(upstream.JSONPath, body)
+		}
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		return "", ErrBadUpstream
+	}
+	if err != nil {
+		return "", err
+	}
+
+	found := false
+	var latest semver.Version
+	var latestText string
+	for _, candidate := range candidates {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "v")
+		v, err := semver.ParseTolerant(candidate)
+		if err != nil {
+			p.logger.WithField("version", candidate).Debug("skipping upstream version that is not semver")
+			continue
+		}
+		if len(v.Pre) > 0 && !upstream.Prereleases {
+			continue
+		}
+		if !found || v.GT(latest) {
+			latest = v
+			latestText = candidate
+			found = true
+		}
+	}
+
+	if !found {
+		return "", ErrNoUpstreamVersions
+	}
+	return latestText, nil
+}
+
+func (c *UpstreamChecker) gitHubVersions(repo string) ([]string, error) {
+	headers := map[string]string{"Accept": "application/vnd.github.v3+json"}
+	if c.GitHubToken != "" {
+		headers["Authorization"] = "token " + c.GitHubToken
+	}
+
+	body, err := c.get(strings.TrimSuffix(c.GitHubAPI, "/")+"/repos/"+repo+"/releases/latest", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	release := struct {
+		TagName string `json:"tag_name"`
+	}{}
+	err = json.Unmarshal(body, &release)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{release.TagName}, nil
+}
+
+func (c *UpstreamChecker) get(url string, headers map[string]string) ([]byte, error) {
+	return fetch(c.Client, url, headers)
+}
+
+// fetch gets the body at url, failing on any status but 200 OK
+func fetch(client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logrus.WithFields(logrus.Fields{
+			"url":    url,
+			"status": resp.Status,
+		}).Error("bad response")
+		return nil, ErrBadResponse
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// patternVersions returns the first group (or the whole match, if there are
+// no groups) of every match of pattern in body
+func patternVersions(pattern string, body []byte) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, match := range re.FindAllSubmatch(body, -1) {
+		if len(match) > 1 {
+			versions = append(versions, string(match[1]))
+		} else {
+			versions = append(versions, string(match[0]))
+		}
+	}
+	return versions, nil
+}
+
+// jsonVersions returns the strings found at a dotted path in a JSON document.
+// "*" in the path matches every item of a list or map.
+func jsonVersions(path string, body []byte) ([]string, error) {
+	var doc interface{}
+	err := json.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{doc}
+	for _, part := range strings.Split(path, ".") {
+		next := []interface{}{}
+		for _, value := range values {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				if part == "*" {
+					for _, inner := range typed {
+						next = append(next, inner)
+					}
+				} else if inner, ok := typed[part]; ok {
+					next = append(next, inner)
+				}
+
+			case []interface{}:
+				if part == "*" {
+					next = append(next, typed...)
+				} else if i, err := strconv.Atoi(part); err == nil && i >= 0 && i < len(typed) {
+					next = append(next, typed[i])
+				}
+			}
+		}
+		values = next
+	}
+
+	versions := []string{}
+	for _, value := range values {
+		if value != nil {
+			versions = append(versions, fmt.Sprint(value))
+		}
+	}
+	return versions, nil
+}
+
+// versionLineRe matches a top-level "version:" line in a spec
+var versionLineRe = regexp.MustCompile(`(?m)^version:[ \t]*(.*?)[ \t]*$`)
+
+// Bump rewrites the version in the package's spec file, and the hashes of the
+// resources listed there, which are downloaded again from their URLs for the
+// new version. The version must be set to a plain value in the spec itself,
+// which must be YAML. A leading "v" on the old version is kept. The file keeps
+// its mode.
+func (c *UpstreamChecker) Bump(p *Package, version string) error {
+	logger := p.logger.WithField("path", p.SpecPath)
+
+	if ext := filepath.Ext(p.SpecPath); ext != ".yml" && ext != ".yaml" {
+		logger.Error(ErrCannotBumpFormat)
+		return ErrCannotBumpFormat
+	}
+
+	info, err := os.Stat(p.SpecPath)
+	if err != nil {
+		logger.WithError(err).Error("could not read spec")
+		return err
+	}
+
+	content, err := ioutil.ReadFile(p.SpecPath)
+	if err != nil {
+		logger.WithError(err).Error("could not read spec")
+		return err
+	}
+
+	match := versionLineRe.FindSubmatch(content)
+	if match == nil || strings.Contains(string(match[1]), "{{") {
+		logger.Error(ErrCannotBump)
+		return ErrCannotBump
+	}
+
+	// keep the quoting style of the existing value, and its "v" prefix
+	value := string(match[1])
+	quote := ""
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		quote = value[:1]
+	}
+	if strings.HasPrefix(strings.Trim(value, quote), "v") && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	updated := versionLineRe.ReplaceAllLiteral(content, []byte("version: "+quote+version+quote))
+
+	// rehash resources at the new version
+	old := p.Version
+	p.Version = version
+	defer func() { p.Version = old }()
+
+	for _, resource := range p.Resources {
+		if resource.Hash == "" {
+			continue
+		}
+
+		url := resource.RenderURL(p)
+		body, err := c.get(url, nil)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"url":   url,
+			}).Error("could not download resource")
+			return err
+		}
+
+		sum, err := resource.sum(body)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"type":  resource.HashType,
+			}).Error("could not sum resource")
+			return err
+		}
+
+		updated, err = replaceResourceHash(updated, resource, sum)
+		if err != nil {
+			logger.WithError(err).Error("could not update resource hash")
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(p.SpecPath, updated, info.Mode().Perm())
+	if err != nil {
+		logger.WithError(err).Error("could not write spec")
+		return err
+	}
+
+	logger.WithField("version", version).Info("bumped version")
+	return nil
+}
+
+// replaceResourceHash replaces the hash of the entries in the spec's top-level
+// resources list that match resource (by URL and hash) with sum. Resources
+// that are inherited from another file are left alone.
+func replaceResourceHash(content []byte, resource Resource, sum string) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return content, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return content, nil
+	}
+
+	var resources *yaml.Node
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "resources" {
+			resources = root.Content[i+1]
+		}
+	}
+	if resources == nil || resources.Kind != yaml.SequenceNode {
+		return content, nil
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	for _, entry := range resources.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+
+		var url, hash *yaml.Node
+		for i := 0; i+1 < len(entry.Content); i += 2 {
+			switch entry.Content[i].Value {
+			case "url":
+				url = entry.Content[i+1]
+			case "hash":
+				hash = entry.Content[i+1]
+			}
+		}
+		if url == nil || hash == nil || url.Value != resource.URL || hash.Value != resource.Hash {
+			continue
+		}
+
+		// the hash is replaced where it is on its line, keeping the rest as is
+		line := lines[hash.Line-1]
+		start := len(string([]rune(line)[:hash.Column-1]))
+		at := strings.Index(line[start:], resource.Hash)
+		if at < 0 {
+			continue
+		}
+		at += start
+		lines[hash.Line-1] = line[:at] + sum + line[at+len(resource.Hash):]
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
@@ -0,0 +1,158 @@
+package hammer
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upstreamServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/hashicorp/consul/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v0.6.4", "name": "v0.6.4"}`)
+	})
+	mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="consul_0.5.2/">0.5.2</a>
+<a href="consul_0.6.4/">0.6.4</a>
+<a href="consul_0.7.0-rc1/">0.7.0-rc1</a>
+<a href="consul_0.6.10/">0.6.10</a>`)
+	})
+	mux.HandleFunc("/repos/hashicorp/short/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v1.2"}`)
+	})
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"versions": {"0.5.2": {"version": "0.5.2"}, "0.6.0": {"version": "0.6.0"}}}`)
+	})
+	mux.HandleFunc("/consul_0.6.4.zip", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "new release")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestUpstreamCheck(t *testing.T) {
+	server := upstreamServer()
+	defer server.Close()
+
+	checker := NewUpstreamChecker()
+	checker.GitHubAPI = server.URL
+
+	cases := []struct {
+		upstream string
+		latest   string
+		err      error
+	}{
+		{"github: hashicorp/consul", "0.6.4", nil},
+		{"github: hashicorp/short", "1.2", nil},
+		{"url: '{{.URL}}/index.html'\n  pattern: 'consul_([0-9.a-z-]+)/'", "0.6.10", nil},
+		{"url: '{{.URL}}/index.html'\n  pattern: 'consul_([0-9.a-z-]+)/'\n  prereleases: true", "0.7.0-rc1", nil},
+		{"url: '{{.URL}}/index.json'\n  json-path: versions.*.version", "0.6.0", nil},
+		{"url: '{{.URL}}/index.json'\n  json-path: nope", "", ErrNoUpstreamVersions},
+		{"url: '{{.URL}}/missing'\n  pattern: x", "", ErrBadResponse},
+		{"url: '{{.URL}}/index.html'", "", ErrBadUpstream},
+		{"prereleases: true", "", ErrBadUpstream},
+	}
+
+	for _, c := range cases {
+		p, err := NewPackageFromYAML([]byte("name: consul\nversion: 0.5.2\nurl: " + server.URL + "\nupstream:\n  " + c.upstream))
+		assert.Nil(t, err, c.upstream)
+
+		status, err := checker.Check(p)
+		if c.err != nil {
+			assert.Equal(t, c.err, err, c.upstream)
+			continue
+		}
+
+		assert.Nil(t, err, c.upstream)
+		assert.Equal(t, "0.5.2", status.Current, c.upstream)
+		assert.Equal(t, c.latest, status.Latest, c.upstream)
+		assert.True(t, status.Outdated, c.upstream)
+	}
+
+	p, err := NewPackageFromYAML([]byte("name: consul\nversion: 0.6.4\nupstream: {github: hashicorp/consul}"))
+	assert.Nil(t, err)
+	status, err := checker.Check(p)
+	assert.Nil(t, err)
+	assert.False(t, status.Outdated)
+
+	_, err = checker.Check(NewPackage())
+	assert.NotNil(t, err)
+}
+
+func TestUpstreamBump(t *testing.T) {
+	server := upstreamServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hammer-upstream-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldHash := strings.Repeat("0", 64)
+	spec := `---
+name: consul
+version: "0.5.2"
+iteration: 1
+# the hash of 0.5.2 was ` + oldHash + `
+vars:
+  previous: ` + oldHash + `
+resources:
+  - url: ` + server.URL + `/consul_{{.Version}}.zip
+    hash-type: sha256
+    hash: "` + oldHash + `"
+multi:
+  - name: consul-ui
+    version: 0.5.2
+`
+	specPath := path.Join(dir, "spec.yml")
+	assert.Nil(t, ioutil.WriteFile(specPath, []byte(spec), 0600))
+
+	p, err := NewPackageFromYAML([]byte(spec))
+	assert.Nil(t, err)
+	p.SpecPath = specPath
+
+	// resources inherited from another file are not rewritten
+	inherited := strings.Repeat("1", 64)
+	p.Resources = append(p.Resources, Resource{URL: server.URL + "/consul_{{.Version}}.zip", HashType: "sha256", Hash: inherited})
+
+	checker := NewUpstreamChecker()
+	assert.Nil(t, checker.Bump(p, "0.6.4"))
+	assert.Equal(t, "0.5.2", p.Version)
+
+	content, err := ioutil.ReadFile(specPath)
+	assert.Nil(t, err)
+	expected := strings.Replace(spec, `version: "0.5.2"`, `version: "0.6.4"`, 1)
+	expected = strings.Replace(expected, `hash: "`+oldHash, `hash: "`+fmt.Sprintf("%x", sha256.Sum256([]byte("new release"))), 1)
+	assert.Equal(t, expected, string(content))
+	assert.NotContains(t, string(content), inherited)
+
+	info, err := os.Stat(specPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// a "v" prefix is kept
+	p = NewPackage()
+	p.SpecPath = specPath
+	assert.Nil(t, ioutil.WriteFile(specPath, []byte("name: consul\nversion: v0.5.2\n"), 0644))
+	assert.Nil(t, checker.Bump(p, "0.6.4"))
+	content, err = ioutil.ReadFile(specPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "name: consul\nversion: v0.6.4\n", string(content))
+
+	// templated versions can't be bumped
+	assert.Nil(t, ioutil.WriteFile(specPath, []byte("name: x\nversion: '{{.Vars.v}}'\n"), 0644))
+	assert.Equal(t, ErrCannotBump, checker.Bump(p, "0.6.4"))
+
+	// and only YAML is rewritten
+	for _, name := range []string{"spec.json", "spec.toml"} {
+		p.SpecPath = path.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(p.SpecPath, []byte(`{"name": "x", "version": "0.5.2"}`), 0644))
+		assert.Equal(t, ErrCannotBumpFormat, checker.Bump(p, "0.6.4"), name)
+	}
+}
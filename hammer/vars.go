@@ -0,0 +1,130 @@
+package hammer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Vars are extra values available to templates, as `{{.Vars.name}}` or
+// `{{variable "name"}}`. Values can be strings, lists (which can be used with
+// `range`) and nested maps. Scalars are kept as the text written in the spec,
+// so `1.10`, `0755` and `yes` render as written rather than as `1.1`, `493`
+// and `true`.
+type Vars map[string]interface{}
+
+// UnmarshalYAML reads Vars, keeping scalars as strings and making sure nested
+// maps have string keys so they can be used in templates and encoded to JSON.
+func (v *Vars) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := map[string]varValue{}
+	err := unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+
+	*v = Vars{}
+	for key, value := range raw {
+		(*v)[key] = value.value
+	}
+
+	return nil
+}
+
+// varValue reads a single value of Vars. YAML gives the original text of any
+// scalar read into a string, so that is tried first.
+type varValue struct {
+	value interface{}
+}
+
+func (v *varValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var scalar string
+	if err := unmarshal(&scalar); err == nil {
+		v.value = scalar
+		return nil
+	}
+
+	var list []varValue
+	if err := unmarshal(&list); err == nil {
+		values := make([]interface{}, len(list))
+		for i, item := range list {
+			values[i] = item.value
+		}
+		v.value = values
+		return nil
+	}
+
+	fields := map[string]varValue{}
+	err := unmarshal(&fields)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	for key, field := range fields {
+		values[key] = field.value
+	}
+	v.value = values
+	return nil
+}
+
+// normalizeValue recursively converts the map[interface{}]interface{} that
+// YAML decodes nested maps to into map[string]interface{}
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for key, inner := range typed {
+			out[fmt.Sprint(key)] = normalizeValue(inner)
+		}
+		return out
+
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for key, inner := range typed {
+			out[key] = normalizeValue(inner)
+		}
+		return out
+
+	case []interface{}:
+		out := make([]interface{}, len(typed))
+		for i, inner := range typed {
+			out[i] = normalizeValue(inner)
+		}
+		return out
+	}
+
+	return value
+}
+
+// Lookup finds a variable by name. The name can be a dotted path into nested
+// maps and lists, like "urls.x86_64" or "plugins.0". A variable whose name
+// contains dots is found before a nested one.
+func (v Vars) Lookup(name string) (interface{}, bool) {
+	if value, ok := v[name]; ok {
+		return value, true
+	}
+
+	var current interface{} = map[string]interface{}(v)
+	for _, part := range strings.Split(name, ".") {
+		switch typed := current.(type) {
+		case map[string]interface{}:
+			value, ok := typed[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(typed) {
+				return nil, false
+			}
+			current = typed[i]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
@@ -0,0 +1,284 @@
+package hammer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	// ErrVerifyFailed is returned when a built package does not contain what
+	// the spec says it should.
+	ErrVerifyFailed = errors.New("package verification failed")
+)
+
+// Verification holds extra assertions about the contents of a built package,
+// on top of the ones implied by Targets and Attrs.
+type Verification struct {
+	// Contains is a list of paths (or path.Match patterns) that must be present
+	Contains []string `yaml:"contains,omitempty"`
+
+	// Excludes is a list of paths (or path.Match patterns) that must not be
+	// present
+	Excludes []string `yaml:"excludes,omitempty"`
+
+	// Attrs are checked against the mode, user and group of the packaged files
+	Attrs []Attr `yaml:"attrs,omitempty"`
+}
+
+// Verify opens the packages produced in the package stage and compares their
+// contents against the rendered Targets, Attrs and Verification. Any mismatch
+// fails the build.
+func (p *Package) Verify() error {
+	if len(p.Artifacts) == 0 {
+		p.logger.Debug("no packages produced, skipping verification")
+		return nil
+	}
+
+	failed := false
+	for _, artifact := range p.Artifacts {
+		logger := p.logger.WithField("artifact", path.Base(artifact.Path))
+
+		entries, err := InspectArchive(artifact.Path)
+		if err == ErrUnknownArchive {
+			logger.Warn("don't know how to inspect package, skipping verification")
+			continue
+		} else if err != nil {
+			logger.WithError(err).Error("could not inspect package")
+			return err
+		}
+
+		problems, err := p.verifyEntries(artifact.Path, entries)
+		if err != nil {
+			logger.WithError(err).Error("could not verify package")
+			return err
+		}
+
+		for _, problem := range problems {
+			logger.Error(problem)
+			failed = true
+		}
+	}
+
+	if failed {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+func (p *Package) verifyEntries(artifact string, entries []ArchiveEntry) ([]string, error) {
+	problems := []string{}
+
+	byPath := map[string]ArchiveEntry{}
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+
+	// config files are only marked in formats that have a notion of them
+	checkConfig := strings.HasSuffix(artifact, ".rpm") || strings.HasSuffix(artifact, ".deb")
+
+	// attrs are passed to FPM for RPMs only. A mode set by an attr (or by a
+	// target) replaces the mode of the staged file, so those files are only
+	// checked against the attr.
+	attrs := []Attr{}
+	attrModes := map[string]bool{}
+	if strings.HasSuffix(artifact, ".rpm") {
+		attrs = append(attrs, p.fpm.targetAttrs()...)
+		attrs = append(attrs, p.Attrs...)
+
+		for _, rawAttr := range attrs {
+			if rawAttr.File == "" || rawAttr.Mode == "" || rawAttr.Mode == "-" {
+				continue
+			}
+			attr, err := rawAttr.render(p)
+			if err != nil {
+				return problems, err
+			}
+			attrModes[path.Clean(attr.File)] = true
+		}
+	}
+
+	// everything in Targets should have made it into the package
+	for _, mapping := range p.fpm.mappings {
+		expected, err := mapping.installedPaths()
+		if err != nil {
+			return problems, err
+		}
+
+		for _, dest := range sortedKeys(expected) {
+			entry, ok := byPath[dest]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing from package", dest))
+				continue
+			}
+
+			if checkConfig && mapping.Target.Config && !entry.Config {
+				problems = append(problems, fmt.Sprintf("%s: not marked as a config file", dest))
+			}
+
+			info, err := os.Lstat(expected[dest])
+			if err != nil {
+				return problems, err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				link, err := os.Readlink(expected[dest])
+				if err != nil {
+					return problems, err
+				}
+				if entry.Link != link {
+					problems = append(problems, fmt.Sprintf("%s: links to %q, expected %q", dest, entry.Link, link))
+				}
+			} else if !info.IsDir() && !attrModes[dest] && entry.Mode.Perm() != info.Mode().Perm() {
+				problems = append(problems, fmt.Sprintf("%s: mode is %o, expected %o", dest, entry.Mode.Perm(), info.Mode().Perm()))
+			}
+		}
+	}
+
+	attrs = append(attrs, p.Verification.Attrs...)
+	for _, rawAttr := range attrs {
+		if rawAttr.File == "" {
+			continue
+		}
+
+		attr, err := rawAttr.render(p)
+		if err != nil {
+			return problems, err
+		}
+
+		entry, ok := byPath[path.Clean(attr.File)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing from package", attr.File))
+			continue
+		}
+		problems = append(problems, attr.check(entry)...)
+	}
+
+	// and finally the explicit assertions
+	for _, rawPattern := range p.Verification.Contains {
+		pattern, err := p.template.RenderField("verify.contains", rawPattern)
+		if err != nil {
+			return problems, err
+		}
+		if !anyEntryMatches(entries, pattern.String()) {
+			problems = append(problems, fmt.Sprintf("%s: expected package to contain a matching path", pattern.String()))
+		}
+	}
+
+	for _, rawPattern := range p.Verification.Excludes {
+		pattern, err := p.template.RenderField("verify.excludes", rawPattern)
+		if err != nil {
+			return problems, err
+		}
+		if anyEntryMatches(entries, pattern.String()) {
+			problems = append(problems, fmt.Sprintf("%s: expected package not to contain a matching path", pattern.String()))
+		}
+	}
+
+	return problems, nil
+}
+
+// installedPaths works out where FPM will put the files in this mapping,
+// following the same rules as `rsync -a src dest`. It returns a map of
+// installed path to the source file on disk.
+func (m targetMapping) installedPaths() (map[string]string, error) {
+	paths := map[string]string{}
+
+	info, err := os.Lstat(m.Src)
+	if err != nil {
+		return paths, err
+	}
+
+	if !info.IsDir() {
+		paths[installedPath(m.Src, m.Dest)] = m.Src
+		return paths, nil
+	}
+
+	// a directory without a trailing slash is copied as a whole, with a slash
+	// only its contents are copied
+	root := m.Dest
+	if !strings.HasSuffix(m.Src, "/") {
+		root = path.Join(m.Dest, filepath.Base(m.Src))
+	}
+
+	err = filepath.Walk(m.Src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.Src, name)
+		if err != nil {
+			return err
+		}
+		paths[path.Join(root, filepath.ToSlash(rel))] = name
+		return nil
+	})
+
+	return paths, err
+}
+
+func (a Attr) render(p *Package) (Attr, error) {
+	file, err := p.template.RenderField("attrs.file", a.File)
+	if err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"error": err,
+			"raw":   a.File,
+		}).Error("failed to render attr file as template")
+		return a, err
+	}
+
+	a.File = file.String()
+	return a, nil
+}
+
+func (a Attr) check(entry ArchiveEntry) []string {
+	problems := []string{}
+
+	if a.Mode != "" && a.Mode != "-" {
+		mode, err := parseMode(a.Mode)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid mode %q", a.File, a.Mode))
+		} else if entry.Mode.Perm() != mode {
+			problems = append(problems, fmt.Sprintf("%s: mode is %o, expected %s", a.File, entry.Mode.Perm(), a.Mode))
+		}
+	}
+
+	if a.User != "" && a.User != "-" && entry.User != a.User {
+		problems = append(problems, fmt.Sprintf("%s: user is %q, expected %q", a.File, entry.User, a.User))
+	}
+
+	if a.Group != "" && a.Group != "-" && entry.Group != a.Group {
+		problems = append(problems, fmt.Sprintf("%s: group is %q, expected %q", a.File, entry.Group, a.Group))
+	}
+
+	return problems
+}
+
+func anyEntryMatches(entries []ArchiveEntry, pattern string) bool {
+	for _, entry := range entries {
+		if entry.Path == path.Clean(pattern) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, entry.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package hammer
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyEntriesModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-verify-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := path.Join(dir, "consul")
+	assert.Nil(t, ioutil.WriteFile(src, []byte("binary"), 0644))
+
+	cases := []struct {
+		artifact string
+		target   Target
+		attrs    []Attr
+		mode     os.FileMode
+		problems []string
+	}{
+		{"consul.rpm", Target{}, nil, 0644, []string{}},
+		{"consul.rpm", Target{}, nil, 0755, []string{"/usr/bin/consul: mode is 755, expected 644"}},
+		{"consul.rpm", Target{Mode: "0755"}, nil, 0755, []string{}},
+		{"consul.rpm", Target{}, []Attr{{File: "/usr/bin/consul", Mode: "0755"}}, 0755, []string{}},
+		{"consul.deb", Target{Mode: "0755"}, nil, 0755, []string{"/usr/bin/consul: mode is 755, expected 644"}},
+	}
+
+	for _, c := range cases {
+		p := NewPackage()
+		p.Attrs = c.attrs
+		p.fpm = &FPM{Package: p, mappings: []targetMapping{{src, "/usr/bin/consul", c.target}}}
+
+		problems, err := p.verifyEntries(c.artifact, []ArchiveEntry{{Path: "/usr/bin/consul", Mode: c.mode}})
+		assert.Nil(t, err, c.artifact)
+		assert.Equal(t, c.problems, problems, c.artifact)
+	}
+}
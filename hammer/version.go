@@ -0,0 +1,231 @@
+package hammer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrBadVersionFrom is returned when version-from does not name exactly
+	// one source.
+	ErrBadVersionFrom = errors.New("version-from needs exactly one of git, file or command")
+
+	// ErrBadIteration is returned when the iteration of a previous build can't
+	// be incremented.
+	ErrBadIteration = errors.New("previous iteration is not a number")
+)
+
+// IterationAuto is the Iteration that makes Hammer pick one more than the
+// iteration of the last build of the same version in OutputRoot, or 1 if
+// there hasn't been one.
+const IterationAuto = "auto"
+
+// DefaultVersionFormat turns the parts of a git describe into a version like
+// "1.2.3" (on a tag) or "1.2.3~git20160102.abc1234" (after one).
+const DefaultVersionFormat = "{{.Tag}}{{if .Commits}}~git{{.Date}}.{{.Hash}}{{end}}"
+
+// VersionFrom derives Version from one of: "git describe" in SpecRoot, the
+// contents of a File (relative to SpecRoot), or the output of a templated
+// shell Command (run in SpecRoot). The result is formatted with Format, which
+// is a template over VersionParts.
+type VersionFrom struct {
+	Git     bool   `yaml:"git,omitempty"`
+	File    string `yaml:"file,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	Format  string `yaml:"format,omitempty"`
+}
+
+// VersionParts are available to the VersionFrom Format template. For files
+// and commands, only Raw and Tag are set.
+type VersionParts struct {
+	Raw     string // the unprocessed version
+	Tag     string // the version, without a leading "v"
+	Commits int    // commits since Tag
+	Hash    string // abbreviated commit hash
+	Date    string // commit date, like 20160102
+}
+
+// ResolveVersion sets Version from VersionFrom, if given. It should be called
+// once SpecRoot is set.
+func (p *Package) ResolveVersion() error {
+	if p.VersionFrom == (VersionFrom{}) {
+		return nil
+	}
+
+	parts, err := p.versionParts()
+	if err != nil {
+		p.logger.WithError(err).Error("could not find version")
+		return err
+	}
+
+	format := p.VersionFrom.Format
+	if format == "" {
+		format = DefaultVersionFormat
+	}
+
+	tmpl, err := template.New("version-from").Parse(format)
+	if err != nil {
+		p.logger.WithError(err).Error("could not parse version format")
+		return err
+	}
+
+	var version bytes.Buffer
+	err = tmpl.Execute(&version, parts)
+	if err != nil {
+		p.logger.WithError(err).Error("could not render version format")
+		return err
+	}
+
+	if p.Version != "" {
+		p.logger.WithField("version", p.Version).Warn("version-from is set, ignoring version")
+	}
+	p.Version = version.String()
+	p.logger.WithField("version", p.Version).Debug("found version")
+
+	return nil
+}
+
+// sources counts how many of git, file and command are set
+func (v VersionFrom) sources() int {
+	sources := 0
+	for _, set := range []bool{v.Git, v.File != "", v.Command != ""} {
+		if set {
+			sources++
+		}
+	}
+	return sources
+}
+
+func (v VersionFrom) hasSource() bool {
+	return v.sources() > 0
+}
+
+func (p *Package) versionParts() (VersionParts, error) {
+	if p.VersionFrom.sources() != 1 {
+		return VersionParts{}, ErrBadVersionFrom
+	}
+
+	if p.VersionFrom.Git {
+		return gitVersionParts(p.SpecRoot)
+	}
+
+	var raw []byte
+	var err error
+	if p.VersionFrom.File != "" {
+		raw, err = ioutil.ReadFile(filepath.Join(p.SpecRoot, p.VersionFrom.File))
+	} else {
+		var command bytes.Buffer
+		command, err = p.template.RenderField("version-from.command", p.VersionFrom.Command)
+		if err != nil {
+			return VersionParts{}, err
+		}
+
+		// TODO: remove the call to viper here in favor of having another piece of configuration in Package
+		shell := viper.GetString("shell")
+		if shell == "" {
+			shell = "sh"
+		}
+
+		cmd := exec.Command(shell, "-c", command.String())
+		cmd.Dir = p.SpecRoot
+		cmd.Stderr = os.Stderr
+		raw, err = cmd.Output()
+	}
+	if err != nil {
+		return VersionParts{}, err
+	}
+
+	version := strings.TrimSpace(string(raw))
+	return VersionParts{Raw: version, Tag: strings.TrimPrefix(version, "v")}, nil
+}
+
+// git describe --long prints tag-commits-ghash
+var describeRe = regexp.MustCompile(`^(.*)-(\d+)-g([0-9a-f]+)$`)
+
+func gitVersionParts(dir string) (VersionParts, error) {
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if exit, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exit.Stderr)))
+		}
+		return strings.TrimSpace(string(out)), err
+	}
+
+	described, err := git("describe", "--tags", "--long")
+	if err != nil {
+		return VersionParts{}, err
+	}
+
+	match := describeRe.FindStringSubmatch(described)
+	if match == nil {
+		return VersionParts{}, fmt.Errorf("could not parse git describe output %q", described)
+	}
+
+	parts := VersionParts{
+		Raw:  described,
+		Tag:  strings.TrimPrefix(match[1], "v"),
+		Hash: match[3],
+	}
+	parts.Commits, _ = strconv.Atoi(match[2])
+
+	timestamp, err := git("log", "-1", "--format=%ct")
+	if err != nil {
+		return parts, err
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return parts, err
+	}
+	parts.Date = time.Unix(seconds, 0).UTC().Format("20060102")
+
+	return parts, nil
+}
+
+// resolveIteration replaces an Iteration of IterationAuto with a number. It
+// looks at the manifest of the last build of this version in OutputRoot and
+// adds one to its iteration. Packages sharing a build use the iteration of the
+// package they share it with.
+func (p *Package) resolveIteration() error {
+	if p.Iteration != IterationAuto {
+		return nil
+	}
+
+	if owner := p.buildOwner(); p.SharedBuild && owner != nil && owner.Iteration != IterationAuto {
+		p.Iteration = owner.Iteration
+		return nil
+	}
+
+	iteration := 1
+	m, err := p.ReadManifest()
+	if err != nil && !os.IsNotExist(err) {
+		p.logger.WithError(err).Error("could not read manifest from a previous build")
+		return err
+	} else if err == nil && m.Iteration != "" {
+		previous, err := strconv.Atoi(m.Iteration)
+		if err != nil {
+			p.logger.WithField("iteration", m.Iteration).Error(ErrBadIteration)
+			return ErrBadIteration
+		}
+
+		iteration = previous + 1
+	}
+
+	p.Iteration = strconv.Itoa(iteration)
+	p.logger.WithField("iteration", p.Iteration).Debug("picked iteration")
+
+	return nil
+}
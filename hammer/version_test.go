@@ -0,0 +1,194 @@
+package hammer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-version-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "VERSION"), []byte("v1.2.3\n"), 0644))
+
+	cases := []struct {
+		from    VersionFrom
+		version string
+	}{
+		{VersionFrom{File: "VERSION"}, "1.2.3"},
+		{VersionFrom{File: "VERSION", Format: "{{.Raw}}-custom"}, "v1.2.3-custom"},
+		{VersionFrom{Command: "echo {{.Name}}-2.0"}, "consul-2.0"},
+		{VersionFrom{Command: "cat VERSION"}, "1.2.3"},
+	}
+
+	for _, c := range cases {
+		p := NewPackage()
+		p.Name = "consul"
+		p.Version = "0.1"
+		p.SpecRoot = dir
+		p.VersionFrom = c.from
+
+		assert.Nil(t, p.ResolveVersion(), c.from.File+c.from.Command)
+		assert.Equal(t, c.version, p.Version, c.from.File+c.from.Command)
+	}
+
+	for _, from := range []VersionFrom{
+		{File: "VERSION", Command: "echo 1"},
+		{Format: "{{.Tag}}"},
+	} {
+		p := NewPackage()
+		p.SpecRoot = dir
+		p.VersionFrom = from
+		assert.Equal(t, ErrBadVersionFrom, p.ResolveVersion())
+	}
+
+	p := NewPackage()
+	p.SpecRoot = dir
+	p.VersionFrom = VersionFrom{File: "MISSING"}
+	assert.True(t, os.IsNotExist(p.ResolveVersion()))
+
+	p.VersionFrom = VersionFrom{Command: "exit 1"}
+	assert.NotNil(t, p.ResolveVersion())
+}
+
+func TestResolveVersionFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "hammer-version-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=hammer", "-c", "user.email=hammer@example.com"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=2016-01-02T03:04:05Z", "GIT_AUTHOR_DATE=2016-01-02T03:04:05Z")
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	git("tag", "v1.2.3")
+
+	p := NewPackage()
+	p.SpecRoot = dir
+	p.VersionFrom = VersionFrom{Git: true}
+	assert.Nil(t, p.ResolveVersion())
+	assert.Equal(t, "1.2.3", p.Version)
+
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	assert.Nil(t, p.ResolveVersion())
+	assert.Regexp(t, `^1\.2\.3~git20160102\.[0-9a-f]+$`, p.Version)
+}
+
+func TestVersionFromInChildren(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-version-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "VERSION"), []byte("1.0.0\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "OTHER"), []byte("2.0.0\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "spec.yml"), []byte(`
+name: parent
+version-from: {file: VERSION}
+multi:
+- name: inherits
+- name: own
+  version-from: {file: OTHER}
+  matrix: {os: [el6, el7]}
+- name: fixed
+  version: 3.0.0
+- name: command
+  version-from: {command: "echo 4.0.0"}
+`), 0644))
+
+	pkgs, err := NewLoader(dir).Load()
+	assert.Nil(t, err)
+	if !assert.Len(t, pkgs, 1) {
+		return
+	}
+
+	versions := map[string]string{}
+	var walk func(*Package)
+	walk = func(p *Package) {
+		versions[strings.TrimSuffix(p.Name+" "+describeCombination(p.Matrix), " ")] = p.Version
+		for _, child := range p.Children {
+			walk(child)
+		}
+	}
+	walk(pkgs[0])
+
+	assert.Equal(t, map[string]string{
+		"parent":     "1.0.0",
+		"inherits":   "1.0.0",
+		"own":        "2.0.0",
+		"own os=el6": "2.0.0",
+		"own os=el7": "2.0.0",
+		"fixed":      "3.0.0",
+		"command":    "4.0.0",
+	}, versions)
+}
+
+func TestResolveIteration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hammer-version-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	newPackage := func(matrix map[string]string) *Package {
+		p := NewPackage()
+		p.Name = "consul"
+		p.Version = "0.5.2"
+		p.Type = "rpm"
+		p.Iteration = IterationAuto
+		p.OutputRoot = dir
+		p.Matrix = matrix
+		return p
+	}
+
+	// nothing built yet
+	p := newPackage(map[string]string{"os": "el7"})
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "1", p.Iteration)
+	assert.Nil(t, p.WriteManifest())
+
+	// the same variant counts up
+	p = newPackage(map[string]string{"os": "el7"})
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "2", p.Iteration)
+	assert.Nil(t, p.WriteManifest())
+
+	p = newPackage(map[string]string{"os": "el7"})
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "3", p.Iteration)
+
+	// other variants keep their own count
+	p = newPackage(map[string]string{"os": "el6"})
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "1", p.Iteration)
+
+	p = newPackage(map[string]string{"os": "el7"})
+	p.Type = "deb"
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "1", p.Iteration)
+
+	// fixed iterations are left alone
+	p = newPackage(map[string]string{"os": "el7"})
+	p.Iteration = "7"
+	assert.Nil(t, p.resolveIteration())
+	assert.Equal(t, "7", p.Iteration)
+
+	// and the previous one has to be a number
+	p = newPackage(map[string]string{"os": "el7"})
+	p.Iteration = "beta"
+	assert.Nil(t, p.WriteManifest())
+	p.Iteration = IterationAuto
+	assert.Equal(t, ErrBadIteration, p.resolveIteration())
+}
@@ -0,0 +1,262 @@
+package hammer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrBadFilter is returned when a filter is not of the form key=value or
+	// key~pattern.
+	ErrBadFilter = errors.New("filter should look like key=value or key~pattern")
+)
+
+// PackageView is a Package with every field rendered, for display and for
+// consumption by other tools. Parent and Children hold package names.
+type PackageView struct {
+	Name         string            `json:"name" yaml:"name"`
+	Version      string            `json:"version" yaml:"version"`
+	Iteration    string            `json:"iteration" yaml:"iteration"`
+	Epoch        string            `json:"epoch,omitempty" yaml:"epoch,omitempty"`
+	Type         string            `json:"type" yaml:"type"`
+	Architecture string            `json:"architecture,omitempty" yaml:"architecture,omitempty"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	License      string            `json:"license,omitempty" yaml:"license,omitempty"`
+	Vendor       string            `json:"vendor,omitempty" yaml:"vendor,omitempty"`
+	URL          string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Depends      []string          `json:"depends" yaml:"depends"`
+	Obsoletes    []string          `json:"obsoletes" yaml:"obsoletes"`
+	Resources    []ResourceView    `json:"resources" yaml:"resources"`
+	Targets      []TargetView      `json:"targets" yaml:"targets"`
+	Scripts      map[string]string `json:"scripts" yaml:"scripts"`
+	Vars         Vars              `json:"vars" yaml:"vars"`
+	Matrix       map[string]string `json:"matrix,omitempty" yaml:"matrix,omitempty"`
+	Overrides    []OverrideView    `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	Artifacts    []Artifact        `json:"artifacts" yaml:"artifacts"`
+	Spec         string            `json:"spec,omitempty" yaml:"spec,omitempty"`
+	Parent       string            `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Children     []string          `json:"children" yaml:"children"`
+}
+
+// ResourceView is a rendered Resource
+type ResourceView struct {
+	URL      string `json:"url" yaml:"url"`
+	Name     string `json:"name" yaml:"name"`
+	HashType string `json:"hash-type" yaml:"hash-type"`
+	Hash     string `json:"hash" yaml:"hash"`
+}
+
+// TargetView is a rendered Target
+type TargetView struct {
+	Src      string `json:"src" yaml:"src"`
+	Dest     string `json:"dest" yaml:"dest"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+	Mode     string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	User     string `json:"user,omitempty" yaml:"user,omitempty"`
+	Group    string `json:"group,omitempty" yaml:"group,omitempty"`
+	Config   bool   `json:"config" yaml:"config"`
+	Template bool   `json:"template" yaml:"template"`
+}
+
+// OverrideView is an Override that was applied to the package
+type OverrideView struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// View renders the package for display. Roots that are only set during a
+// build (like BuildRoot) render as empty strings.
+func (p *Package) View() (*PackageView, error) {
+	v := &PackageView{
+		Depends:   []string{},
+		Obsoletes: []string{},
+		Resources: []ResourceView{},
+		Targets:   []TargetView{},
+		Scripts:   map[string]string{},
+		Vars:      p.Vars,
+		Matrix:    p.Matrix,
+		Artifacts: p.Artifacts,
+		Spec:      p.SpecPath,
+		Children:  []string{},
+	}
+	if v.Vars == nil {
+		v.Vars = Vars{}
+	}
+	if v.Artifacts == nil {
+		v.Artifacts = []Artifact{}
+	}
+
+	fields := []struct {
+		name string
+		raw  string
+		dest *string
+	}{
+		{"name", p.Name, &v.Name},
+		{"version", p.Version, &v.Version},
+		{"iteration", p.Iteration, &v.Iteration},
+		{"epoch", p.Epoch, &v.Epoch},
+		{"type", p.Type, &v.Type},
+		{"architecture", p.Architecture, &v.Architecture},
+		{"description", p.Description, &v.Description},
+		{"license", p.License, &v.License},
+		{"vendor", p.Vendor, &v.Vendor},
+		{"url", p.URL, &v.URL},
+	}
+	for _, field := range fields {
+		rendered, err := p.template.RenderField(field.name, field.raw)
+		if err != nil {
+			return nil, err
+		}
+		*field.dest = rendered.String()
+	}
+
+	for _, list := range []struct {
+		name string
+		raw  []string
+		dest *[]string
+	}{
+		{"depends", p.Depends, &v.Depends},
+		{"obsoletes", p.Obsoletes, &v.Obsoletes},
+	} {
+		for _, raw := range list.raw {
+			rendered, err := p.template.RenderField(list.name, raw)
+			if err != nil {
+				return nil, err
+			}
+			*list.dest = append(*list.dest, rendered.String())
+		}
+	}
+
+	for _, resource := range p.Resources {
+		v.Resources = append(v.Resources, ResourceView{
+			URL:      resource.RenderURL(p),
+			Name:     resource.Name(p),
+			HashType: resource.HashType,
+			Hash:     resource.Hash,
+		})
+	}
+
+	for i, target := range p.allTargets() {
+		src, err := p.template.RenderField(fmt.Sprintf("targets[%d].src", i), target.Src)
+		if err != nil {
+			return nil, err
+		}
+		dest, err := p.template.RenderField(fmt.Sprintf("targets[%d].dest", i), target.Dest)
+		if err != nil {
+			return nil, err
+		}
+
+		v.Targets = append(v.Targets, TargetView{
+			Src:      src.String(),
+			Dest:     dest.String(),
+			Type:     target.Type,
+			Mode:     target.Mode,
+			User:     target.User,
+			Group:    target.Group,
+			Config:   target.Config,
+			Template: target.Template,
+		})
+	}
+
+	scripts := p.allScripts()
+	for name := range scripts {
+		content, err := scripts.Content(p, name)
+		if err != nil {
+			return nil, err
+		}
+		v.Scripts[name] = content.String()
+	}
+
+	for _, override := range p.Overrides {
+		v.Overrides = append(v.Overrides, OverrideView{
+			Key:    override.Key,
+			Value:  override.Value,
+			Source: override.Source,
+		})
+	}
+
+	if p.Parent != nil {
+		v.Parent = p.Parent.Name
+	}
+	for _, child := range p.Children {
+		v.Children = append(v.Children, child.Name)
+	}
+
+	return v, nil
+}
+
+// Filter selects packages by a field of their PackageView. With "=" the field
+// must equal Value; with "~" it must match the regular expression Pattern.
+// Fields are named as in JSON output, and can be a dotted path like
+// "vars.channel". For lists, any item may match.
+type Filter struct {
+	Key     string
+	Value   string
+	Pattern *regexp.Regexp
+}
+
+// ParseFilter reads a filter from "key=value" or "key~pattern"
+func ParseFilter(expr string) (Filter, error) {
+	i := strings.IndexAny(expr, "=~")
+	if i < 1 {
+		return Filter{}, ErrBadFilter
+	}
+
+	f := Filter{Key: expr[:i], Value: expr[i+1:]}
+	if expr[i] == '~' {
+		pattern, err := regexp.Compile(f.Value)
+		if err != nil {
+			return f, err
+		}
+		f.Pattern = pattern
+	}
+
+	return f, nil
+}
+
+// Match checks a view against the filter
+func (f Filter) Match(v *PackageView) bool {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(content, &fields)
+	if err != nil {
+		return false
+	}
+
+	value, ok := Vars(fields).Lookup(f.Key)
+	if !ok {
+		return false
+	}
+
+	candidates := []interface{}{value}
+	if list, ok := value.([]interface{}); ok {
+		candidates = list
+	}
+
+	for _, candidate := range candidates {
+		s := fmt.Sprint(candidate)
+		if f.Pattern != nil && f.Pattern.MatchString(s) || f.Pattern == nil && s == f.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Flatten returns the packages and all their descendants, each parent before
+// its children
+func Flatten(pkgs []*Package) []*Package {
+	out := []*Package{}
+	for _, pkg := range pkgs {
+		out = append(out, pkg)
+		out = append(out, Flatten(pkg.Children)...)
+	}
+	return out
+}
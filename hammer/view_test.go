@@ -0,0 +1,131 @@
+package hammer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	cases := []struct {
+		expr    string
+		key     string
+		value   string
+		pattern bool
+		err     bool
+	}{
+		{"name=consul", "name", "consul", false, false},
+		{"vars.channel=beta", "vars.channel", "beta", false, false},
+		{"version~^0\\.5", "version", "^0\\.5", true, false},
+		{"url=http://example.com/?a=b", "url", "http://example.com/?a=b", false, false},
+		{"name=", "name", "", false, false},
+		{"name", "", "", false, true},
+		{"=consul", "", "", false, true},
+		{"name~(", "", "", false, true},
+	}
+
+	for _, c := range cases {
+		f, err := ParseFilter(c.expr)
+		if c.err {
+			assert.NotNil(t, err, c.expr)
+			continue
+		}
+
+		assert.Nil(t, err, c.expr)
+		assert.Equal(t, c.key, f.Key, c.expr)
+		assert.Equal(t, c.value, f.Value, c.expr)
+		assert.Equal(t, c.pattern, f.Pattern != nil, c.expr)
+	}
+
+	_, err := ParseFilter("name")
+	assert.Equal(t, ErrBadFilter, err)
+}
+
+func TestFilterMatch(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`
+name: consul
+version: 0.5.2
+type: rpm
+depends: [glibc, "consul-ui >= {{.Version}}"]
+vars:
+  channel: beta
+  urls: {x86_64: http://example.com/consul}
+targets:
+- {src: consul, dest: /usr/bin/}
+- {src: consul.json, dest: /etc/consul/, config: true}
+`))
+	assert.Nil(t, err)
+
+	view, err := p.View()
+	assert.Nil(t, err)
+
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		// exact
+		{"name=consul", true},
+		{"name=consu", false},
+		{"type=rpm", true},
+		{"vars.channel=beta", true},
+		{"vars.urls.x86_64=http://example.com/consul", true},
+		{"vars.missing=beta", false},
+		{"nope=consul", false},
+
+		// regular expressions
+		{"name~^con", true},
+		{"name~ui$", false},
+		{"version~^0\\.5\\.", true},
+		{"vars.channel~^(beta|stable)$", true},
+
+		// any item of a list, with templates rendered
+		{"depends=glibc", true},
+		{"depends=consul-ui >= 0.5.2", true},
+		{"depends~^consul-ui", true},
+		{"depends=musl", false},
+		{"targets.dest=/etc/consul/", false}, // lists of objects aren't walked
+	}
+
+	for _, c := range cases {
+		f, err := ParseFilter(c.expr)
+		assert.Nil(t, err, c.expr)
+		assert.Equal(t, c.match, f.Match(view), c.expr)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	p, err := NewPackageFromYAML([]byte(`
+name: consul
+version: 0.5.2
+matrix:
+  os: [el6, el7]
+multi:
+- name: consul-ui
+- name: consul-extra
+  multi:
+  - name: consul-extra-docs
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, p.ExpandRecursive(nil))
+
+	other := NewPackage()
+	other.Name = "etcd"
+
+	names := []string{}
+	for _, pkg := range Flatten([]*Package{p, other}) {
+		names = append(names, pkg.Name+" "+describeCombination(pkg.Matrix))
+	}
+
+	// parents come before their children, and everything keeps its order
+	assert.Equal(t, []string{
+		"consul ",
+		"consul-ui ",
+		"consul-extra ",
+		"consul-extra-docs ",
+		"consul os=el6",
+		"consul os=el7",
+		"etcd ",
+	}, names)
+
+	assert.Equal(t, []*Package{}, Flatten(nil))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importCmd = &cobra.Command{
+		Use:   "import path",
+		Short: "convert an RPM .spec or Debian control file into a spec",
+		Long:  "convert an RPM .spec file, or a Debian control file and maintainer scripts (given as the control file or a directory holding it, or debian/), into a spec. Anything that could not be converted is listed in a comment at the top of the spec. The spec is printed unless --output is given.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				logrus.Fatal("expected a single path to import (try `hammer help import`)")
+			}
+
+			imported, err := hammer.ImportPath(args[0])
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+					"path":  args[0],
+				}).Fatal("could not import")
+			}
+
+			for _, warning := range imported.Warnings {
+				logrus.WithField("path", imported.Source).Warn(warning)
+			}
+
+			content, err := imported.YAML()
+			if err != nil {
+				logrus.WithError(err).Fatal("could not render spec")
+			}
+
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --output")
+			}
+			if output == "" {
+				os.Stdout.Write(content)
+				return
+			}
+
+			for _, name := range hammer.SpecNames {
+				existing := filepath.Join(output, name)
+				if _, err := os.Stat(existing); err == nil {
+					logrus.WithField("path", existing).Fatal(hammer.ErrSpecExists)
+				}
+			}
+			spec := filepath.Join(output, "spec.yml")
+
+			err = os.MkdirAll(output, 0755)
+			if err == nil {
+				err = ioutil.WriteFile(spec, content, 0644)
+			}
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+					"path":  spec,
+				}).Fatal("could not write spec")
+			}
+			logrus.WithField("path", spec).Info("wrote spec")
+		},
+	}
+)
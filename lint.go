@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	lintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "check specs for mistakes",
+		Long:  "check each spec file against the schema (see `hammer schema`), then every package as loaded (including multi, matrix and subpackage children, project defaults and overrides) against the schema again, including its required fields, and for missing fields, targets without a source and templates that don't render, without building anything.",
+		Run: func(cmd *cobra.Command, args []string) {
+			loader := hammer.NewLoader(viper.GetString("search"))
+			loader.Overrides = overrides(cmd)
+			loaded, err := loader.Load()
+			if err != nil {
+				logrus.WithField("error", err).Fatal("could not load packages")
+			}
+
+			if lint(loaded) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// lint prints the problems with each spec and package and returns how many
+// there were. Problems found in a spec file aren't repeated for the packages
+// loaded from it.
+func lint(pkgs []*hammer.Package) int {
+	count := 0
+	reported := map[string]bool{}
+	for _, pkg := range pkgs {
+		content, err := ioutil.ReadFile(pkg.SpecPath)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"path":  pkg.SpecPath,
+			}).Error("could not read spec")
+			count++
+			continue
+		}
+
+		var problems []hammer.Problem
+		content, err = hammer.DecodeSpec(pkg.SpecPath, content)
+		if err == nil {
+			problems, err = hammer.ValidateSpec(content)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"path":  pkg.SpecPath,
+			}).Error("could not validate spec")
+			count++
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", pkg.SpecPath, problem)
+			reported[pkg.SpecPath+": "+problem.String()] = true
+			count++
+		}
+	}
+
+	for _, pkg := range hammer.Flatten(pkgs) {
+		for _, problem := range pkg.Lint() {
+			if reported[pkg.SpecPath+": "+problem.String()] {
+				continue
+			}
+			fmt.Printf("%s: %s: %s\n", pkg.SpecPath, pkg.Name, problem)
+			count++
+		}
+	}
+	return count
+}
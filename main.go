@@ -6,6 +6,7 @@ import (
 	"runtime"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -22,6 +23,7 @@ var (
 			logrus.Fatal("no command specified (try `hammer help build`)")
 		},
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			setupConfig(cmd)
 			setupLogging()
 		},
 	}
@@ -31,6 +33,7 @@ func init() {
 	// root and persistent flags
 	rootCmd.PersistentFlags().String("log-level", "info", "one of debug, info, warn, error, or fatal")
 	rootCmd.PersistentFlags().String("log-format", "text", "specify output (text or json)")
+	rootCmd.PersistentFlags().Bool("strict-templates", false, "fail on references to missing keys in templates")
 
 	// build flags
 	buildCmd.Flags().String("shell", "bash", "shell to use for executing build scripts")
@@ -47,6 +50,46 @@ func init() {
 	buildCmd.Flags().String("cache", path.Join(cwd, ".hammer-cache"), "where to cache downloads")
 	buildCmd.Flags().Bool("skip-cleanup", false, "skip cleanup step")
 
+	// query flags
+	queryCmd.Flags().String("format", "table", "output format when no template is given: json, yaml or table")
+	queryCmd.Flags().StringArray("filter", nil, "only show packages where a field matches, like type=rpm or name~consul")
+	queryCmd.Flags().Bool("children", false, "include multi, matrix and subpackage children")
+
+	// graph flags
+	graphCmd.Flags().String("format", "tree", "output format: dot, mermaid or tree")
+
+	// new flags
+	newCmd.Flags().String("skeleton", "go-binary", "skeleton to start from (see --list)")
+	newCmd.Flags().String("skeletons", defaultSkeletonDir(), "directory of user skeletons")
+	newCmd.Flags().Bool("list", false, "list the available skeletons")
+	newCmd.Flags().String("version", "0.1.0", "package version")
+	newCmd.Flags().String("type", "rpm", "package type")
+	newCmd.Flags().String("description", "", "package description (defaults to the name)")
+	newCmd.Flags().String("license", "", "package license")
+	newCmd.Flags().String("vendor", "", "package vendor")
+	newCmd.Flags().String("url", "", "project homepage")
+	newCmd.Flags().String("github", "", "GitHub repository (owner/repo) for releases and upstream checks")
+	newCmd.Flags().String("source", "", "URL of the resource to package, may use template fields like {{.Version}}")
+	newCmd.Flags().String("hash-type", "sha256", "hash type for the resource")
+	newCmd.Flags().String("hash", "", "hash of the resource, instead of downloading it")
+	newCmd.Flags().Bool("no-fetch", false, "don't download the resource to compute its hash")
+
+	// import flags
+	importCmd.Flags().String("output", "", "directory to write spec.yml to, instead of printing it")
+
+	// fmt flags
+	fmtCmd.Flags().Bool("check", false, "list unformatted specs and exit with an error instead of rewriting them")
+
+	// outdated flags
+	outdatedCmd.Flags().Bool("bump", false, "rewrite outdated specs to the latest version, and update resource hashes")
+	outdatedCmd.Flags().String("github-api", hammer.DefaultGitHubAPI, "base URL of the GitHub API")
+
+	// overrides, read directly from the command's flags since they are lists
+	for _, cmd := range []*cobra.Command{buildCmd, queryCmd, outdatedCmd, graphCmd, lintCmd} {
+		cmd.Flags().StringArray("set", nil, "override a spec field, like version=1.2.3 or vars.channel=beta")
+		cmd.Flags().StringArray("set-file", nil, "override a spec field with the content of a file, like vars.notes=NOTES.md")
+	}
+
 	for _, flags := range []*pflag.FlagSet{rootCmd.PersistentFlags(), buildCmd.Flags()} {
 		err := viper.BindPFlags(flags)
 		if err != nil {
@@ -56,7 +99,7 @@ func init() {
 }
 
 func main() {
-	rootCmd.AddCommand(buildCmd, queryCmd)
+	rootCmd.AddCommand(buildCmd, queryCmd, outdatedCmd, graphCmd, lintCmd, newCmd, importCmd, fmtCmd, schemaCmd)
 	err := rootCmd.Execute()
 	if err != nil {
 		logrus.WithField("error", err).Fatal("exited with error")
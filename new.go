@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	newCmd = &cobra.Command{
+		Use:   "new name [directory]",
+		Short: "start a new spec from a skeleton",
+		Long:  "generate a spec directory (by default named after the package, in the search path) from a built-in or user skeleton, filling in fields from flags. The first resource is downloaded to compute its hash, and the result is linted.",
+		Run: func(cmd *cobra.Command, args []string) {
+			flag := func(name string) string {
+				value, err := cmd.Flags().GetString(name)
+				if err != nil {
+					logrus.WithError(err).Fatalf("could not read --%s", name)
+				}
+				return value
+			}
+
+			skeletonDir := flag("skeletons")
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				for _, name := range hammer.SkeletonNames(skeletonDir) {
+					fmt.Println(name)
+				}
+				return
+			}
+
+			if len(args) < 1 || len(args) > 2 {
+				logrus.Fatal("expected a package name, and optionally a directory (try `hammer help new`)")
+			}
+
+			scaffold := hammer.NewScaffold(flag("skeleton"))
+			scaffold.SkeletonDir = skeletonDir
+			scaffold.Fields.Name = args[0]
+			for name, dest := range map[string]*string{
+				"version":     &scaffold.Fields.Version,
+				"type":        &scaffold.Fields.Type,
+				"description": &scaffold.Fields.Description,
+				"license":     &scaffold.Fields.License,
+				"vendor":      &scaffold.Fields.Vendor,
+				"url":         &scaffold.Fields.URL,
+				"github":      &scaffold.Fields.GitHub,
+				"source":      &scaffold.Fields.Source,
+				"hash-type":   &scaffold.Fields.HashType,
+				"hash":        &scaffold.Fields.Hash,
+			} {
+				if cmd.Flags().Changed(name) {
+					*dest = flag(name)
+				}
+			}
+			if scaffold.Fields.Description == "" {
+				scaffold.Fields.Description = scaffold.Fields.Name
+			}
+			if noFetch, _ := cmd.Flags().GetBool("no-fetch"); noFetch {
+				scaffold.Fetch = false
+			}
+
+			dir := filepath.Join(viper.GetString("search"), args[0])
+			if len(args) == 2 {
+				dir = args[1]
+			}
+
+			spec, err := scaffold.Generate(dir)
+			if err == hammer.ErrNoSource {
+				logrus.WithField("skeleton", scaffold.Skeleton).Fatal("please provide --source (or --github, for go-binary) to fill in the resource")
+			} else if err != nil {
+				logrus.WithError(err).Fatal("could not generate spec")
+			}
+			logrus.WithField("path", spec).Info("wrote spec")
+
+			// load from the search path so that project defaults apply, unless
+			// the spec was written outside of it
+			loaded := loadSpec(viper.GetString("search"), spec)
+			if len(loaded) == 0 {
+				loaded = loadSpec(dir, spec)
+			}
+			if len(loaded) == 0 {
+				logrus.WithField("path", spec).Fatal("could not load generated spec")
+			}
+
+			if lint(loaded) > 0 {
+				logrus.WithField("path", spec).Warn("generated spec has problems, edit it before building")
+			}
+		},
+	}
+)
+
+// loadSpec loads the packages below root and returns the one read from the
+// spec at path, if any
+func loadSpec(root, path string) []*hammer.Package {
+	want, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+
+	loaded, err := hammer.NewLoader(root).Load()
+	if err != nil {
+		return nil
+	}
+
+	for _, pkg := range loaded {
+		if found, err := filepath.Abs(pkg.SpecPath); err == nil && found == want {
+			return []*hammer.Package{pkg}
+		}
+	}
+	return nil
+}
+
+// defaultSkeletonDir is where user skeletons are looked for by default
+func defaultSkeletonDir() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".hammer", "skeletons")
+}
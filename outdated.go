@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	outdatedCmd = &cobra.Command{
+		Use:   "outdated [package...]",
+		Short: "check packages for new upstream versions",
+		Long:  "check every package with an upstream block (or only the ones specified) for new releases, and print a table of versions. With --bump, outdated specs are updated to the latest version.",
+		Run: func(cmd *cobra.Command, packageNames []string) {
+			loader := hammer.NewLoader(viper.GetString("search"))
+			loader.Overrides = overrides(cmd)
+			loaded, err := loader.Load()
+			if err != nil {
+				logrus.WithField("error", err).Fatal("could not load packages")
+			}
+
+			selected := map[string]bool{}
+			for _, name := range packageNames {
+				selected[name] = true
+			}
+
+			bump, err := cmd.Flags().GetBool("bump")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --bump")
+			}
+
+			checker := hammer.NewUpstreamChecker()
+			checker.GitHubAPI, err = cmd.Flags().GetString("github-api")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --github-api")
+			}
+			checker.GitHubToken = os.Getenv("GITHUB_TOKEN")
+
+			table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(table, "NAME\tCURRENT\tLATEST\tSTATUS")
+
+			failed := false
+			for _, pkg := range loaded {
+				if len(selected) > 0 && !selected[pkg.Name] {
+					continue
+				}
+				if pkg.Upstream == (hammer.Upstream{}) {
+					if len(selected) > 0 {
+						logrus.WithField("name", pkg.Name).Warn("package has no upstream")
+					}
+					continue
+				}
+
+				status, err := checker.Check(pkg)
+				if err != nil {
+					failed = true
+					fmt.Fprintf(table, "%s\t%s\t%s\terror: %s\n", pkg.Name, status.Current, "-", err)
+					continue
+				}
+
+				state := "up to date"
+				if status.Outdated {
+					state = "outdated"
+
+					if bump {
+						err = checker.Bump(pkg, status.Latest)
+						if err != nil {
+							failed = true
+							state = "error: " + err.Error()
+						} else {
+							state = "bumped"
+						}
+					}
+				}
+
+				fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", status.Name, status.Current, status.Latest, state)
+			}
+
+			err = table.Flush()
+			if err != nil {
+				logrus.WithError(err).Fatal("could not write table")
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+)
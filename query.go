@@ -1,37 +1,150 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"text/tabwriter"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/asteris-llc/hammer/hammer"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
 )
 
 var (
 	queryCmd = &cobra.Command{
-		Use:   "query {template}",
+		Use:   "query [template]",
 		Short: "query found packages and render information into a template",
-		Long:  "provide a template to render, that will include information about the builds. The template will be rendered once per line.",
+		Long:  "provide a template to render, that will include information about the builds. The template will be rendered once per line. Without a template, packages are printed in the format given by --format.",
 		Run: func(cmd *cobra.Command, tmpls []string) {
-			if len(tmpls) != 1 {
-				logrus.Fatal("please provide exactly one template")
+			if len(tmpls) > 1 {
+				logrus.Fatal("please provide at most one template")
+			}
+
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --format")
+			}
+			if len(tmpls) == 1 && cmd.Flags().Lookup("format").Changed {
+				logrus.Fatal("please provide either a template or --format, not both")
+			}
+
+			children, err := cmd.Flags().GetBool("children")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --children")
+			}
+
+			filters := []hammer.Filter{}
+			exprs, err := cmd.Flags().GetStringArray("filter")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not read --filter")
+			}
+			for _, expr := range exprs {
+				filter, err := hammer.ParseFilter(expr)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"error":  err,
+						"filter": expr,
+					}).Fatal("could not read --filter")
+				}
+				filters = append(filters, filter)
 			}
 
 			loader := hammer.NewLoader(viper.GetString("search"))
+			loader.Overrides = overrides(cmd)
 			loaded, err := loader.Load()
 
 			if err != nil {
 				logrus.WithField("error", err).Fatal("could not load packages")
 			}
 
+			if children {
+				loaded = hammer.Flatten(loaded)
+			}
+
+			// views are only rendered when filtering or printing them, so a
+			// template only has to render the fields it uses
+			needViews := len(tmpls) == 0 || len(filters) > 0
+
+			packages := []*hammer.Package{}
+			views := []*hammer.PackageView{}
 			for _, pkg := range loaded {
-				rendered, err := pkg.Render(tmpls[0])
+				err := pkg.LoadArtifacts()
+				if err != nil {
+					logrus.WithField("error", err).Warn("could not read manifest from a previous build")
+				}
+
+				var view *hammer.PackageView
+				if needViews {
+					view, err = pkg.View()
+					if err != nil {
+						logrus.WithFields(logrus.Fields{
+							"error": err,
+							"name":  pkg.Name,
+						}).Warn("could not render package, skipping")
+						continue
+					}
+				}
+
+				matches := true
+				for _, filter := range filters {
+					if !filter.Match(view) {
+						matches = false
+						break
+					}
+				}
+
+				if matches {
+					packages = append(packages, pkg)
+					views = append(views, view)
+				}
+			}
+
+			if len(tmpls) == 1 {
+				for _, pkg := range packages {
+					rendered, err := pkg.Render(tmpls[0])
+					if err != nil {
+						logrus.WithFields(logrus.Fields{
+							"error": err,
+							"name":  pkg.Name,
+						}).Fatal("could not render template")
+					}
+
+					fmt.Println(rendered.String())
+				}
+				return
+			}
+
+			switch format {
+			case "json":
+				out, err := json.MarshalIndent(views, "", "  ")
+				if err != nil {
+					logrus.WithError(err).Fatal("could not encode packages")
+				}
+				fmt.Println(string(out))
+
+			case "yaml":
+				out, err := yaml.Marshal(views)
+				if err != nil {
+					logrus.WithError(err).Fatal("could not encode packages")
+				}
+				fmt.Print(string(out))
+
+			case "table":
+				table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				fmt.Fprintln(table, "NAME\tVERSION\tITERATION\tTYPE\tARCHITECTURE\tPARENT")
+				for _, view := range views {
+					fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", view.Name, view.Version, view.Iteration, view.Type, view.Architecture, view.Parent)
+				}
+				err := table.Flush()
 				if err != nil {
-					logrus.WithField("error", err).Fatal("could not render template")
+					logrus.WithError(err).Fatal("could not write table")
 				}
 
-				fmt.Println(rendered.String())
+			default:
+				logrus.WithField("format", format).Fatal("unknown format (try json, yaml or table)")
 			}
 		},
 	}
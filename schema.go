@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/asteris-llc/hammer/hammer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "print the JSON Schema for specs",
+		Long:  "print a JSON Schema describing spec.yml, generated from the fields Hammer reads. Editors can use it to complete and check specs as they are written; `hammer lint` checks specs against the same schema.",
+		Run: func(cmd *cobra.Command, args []string) {
+			out, err := json.MarshalIndent(hammer.Schema(), "", "  ")
+			if err != nil {
+				logrus.WithError(err).Fatal("could not render schema")
+			}
+			fmt.Println(string(out))
+		},
+	}
+)